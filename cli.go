@@ -1,29 +1,53 @@
 package main
 
 import(
+  "io"
   "os"
   "fmt"
   "path"
+  "bufio"
+  "errors"
   "strings"
   "strconv"
-  "archive/zip"
   _ "embed"
+
+  "github.com/MD-IS/levt/epub"
+  "github.com/MD-IS/levt/render"
+  "github.com/MD-IS/levt/tui"
 )
 
 //go:embed version.txt
 var version string
 
-var epubContent = make(map[string]*zip.File)
-
 func printHelp() {
   fmt.Printf(`
 LEVT Version %s
 Usage: %s [-f] <path/to/file.epub> [-i pagenumber]  
 
+The book may also be a directory holding an unpacked EPUB, with
+its mimetype and META-INF/container.xml.
+
 Flags:
   -h: Print this message
   -lf <to/file.epub>: List content of <file.epub>
-  -mf <to/file.epub>: Print Metadata of <file.epub>
+  -mf <to/file.epub>: Print Metadata and cover of <file.epub>
+  -m Cover: Open the cover image with xdg-open
+  -sf <to/file.epub>, --strict <to/file.epub>: Print the markup
+     problems met reading <file.epub>, exiting with 1 if any
+
+Keys:
+  t: Table of contents (ENTER jump, SPACE expand)
+  ENTER: Follow link or show footnote (n/p next note)
+  J: Justify text
+  R: Ruby readings above the text, in parentheses or hidden
+  V: Vertical text, where LEFT/RIGHT turn pages and [ ] chapters
+  -: Hyphenation on/off, patterns are read from hyph-<lang>.pat.txt
+     or hyph_<lang>.dic in the levt config dir or the system's
+     hyphenation directories
+
+Environment:
+  LEVT_GRAPHICS: How to draw images, one of kitty, iterm, sixel,
+     truecolor or blocks, instead of what the terminal advertises
 
 `, version, os.Args[0])
 }
@@ -32,7 +56,12 @@ func parseOpt(args []string) map[rune]string {
   opt := make(map[rune]string)
   for i, v := range args {
     if v == "--" {break}
-    if v[0] != '-' {continue}
+    // --strict takes no value, the book being given as usual.
+    if v == "--strict" {
+      opt['s'] = ""
+      continue
+    }
+    if v == "" || v[0] != '-' {continue}
     for _, c := range v[1:] {
       if (i + 1) < len(args) {
         optValue := args[i + 1]
@@ -49,6 +78,24 @@ func parseOpt(args []string) map[rune]string {
   return opt
 }
 
+// firstArg returns the first argument that is neither a flag nor
+// the value of one.
+func firstArg(args []string) string {
+  for i := 0; i < len(args); i++ {
+    v := args[i]
+    switch {
+      case v == "--strict": {}
+      case v == "--": {
+        if i + 1 < len(args) {return args[i + 1]}
+        return ""
+      }
+      case v != "" && v[0] == '-': {i++}
+      default: {return v}
+    }
+  }
+  return ""
+}
+
 func main() {
   args := os.Args[1:]
   opt := parseOpt(args)
@@ -73,11 +120,10 @@ func main() {
     }
   }
 
-  if (epubPath == "") && (len(args) > 0) &&
-      (args[0][0] != '-') {epubPath = args[0]}
+  if epubPath == "" {epubPath = firstArg(args)}
 
   if epubPath == "" && htmlPath == "" {
-    config, err := getConfig()
+    config, err := tui.GetConfig()
     if err != nil {
       fmt.Println(err)
       os.Exit(17)
@@ -88,9 +134,9 @@ func main() {
       os.Exit(0)
     }
 
-    config.onExit = func(i int) {
+    config.OnExit = func(i int) {
       if i < 0 {return}
-      var sc StartConf
+      var sc tui.StartConf
 
       if i >= len(c) {
         sc = config.LastRead
@@ -127,29 +173,38 @@ func main() {
   }
 
   if htmlPath != "" {
-    (&EpubViewer{
+    (&tui.Viewer{
       Cursor: cursor,
       FilePath: htmlPath,
-      EpubItems: []EpubItem{{Href: htmlPath}},
+      Files: epub.Dir(""),
+      EpubItems: render.Documents(epub.Dir(""), []epub.Chapter{{Item: epub.Item{Href: htmlPath}}}),
+      Screen: render.NewScreen(render.DetectGraphics()),
     }).StartProgram()
     os.Exit(0)
   }
 
-  reader, err := zip.OpenReader(epubPath)
-  if err != nil {
-    fmt.Println(err)
-    os.Exit(2)
-  }
-  defer reader.Close()
-
-  for _, file := range reader.File {
-    epubContent[file.Name] = file
+  book, err := epub.Open(epubPath)
+  switch {
+    case errors.Is(err, epub.ErrMimeType): {
+      fmt.Println("Invalid Epub file")
+      os.Exit(43)
+    }
+    case errors.Is(err, epub.ErrContainer): {
+      fmt.Println("Invalid Epub file")
+      os.Exit(44)
+    }
+    case errors.Is(err, epub.ErrPackage): {
+      fmt.Println("Invalid Epub file")
+      os.Exit(45)
+    }
+    case err != nil: {
+      fmt.Println(err)
+      os.Exit(2)
+    }
   }
-
-  VerifyMimeType(epubContent[MimetypePath])
-  cont := ParseContainer(epubContent[ContainerPath])
-  opfPath := cont.RootFiles.Files[0].FullPath
-  opf := ParseOPF(epubContent[opfPath])
+  defer book.Close()
+  opf := &book.OPF
+  files := book.Files
 
   if arg, ok := opt['m']; ok {
     // (-m) Print Metadata then Exit
@@ -175,29 +230,21 @@ func main() {
       fmt.Printf("Locale: %s\n", loc)
     }
 
-    for _, m := range opf.Metadata.MetaTags {
-      if m.Name == "cover" {
-        if arg == "Cover" {
-          var href string
-          lastSlash := strings.LastIndex(opfPath, "/")
-          opfBase := opfPath[:lastSlash + 1]
-          for _, item := range opf.Manifest.Items {
-            if item.Id == m.Content {href = item.Href}
-          }
-          if href != "" {
-            open(opfBase + href)
-          } else {
-            fmt.Println("\nnot found", m.Content)
-          }
-        } else {
-          fmt.Println("\nuse '-m Cover' for cover")
-        }
+    cover, _ := book.Cover()
+    if cover != "" && arg == "Cover" {
+      tui.Open(files, cover)
+    } else if cover != "" {
+      if pic := render.ReadPicture(files, cover, "Cover"); pic != nil {
+        fmt.Println()
+        tui.PrintCover(render.NewScreen(render.DetectGraphics()), pic)
+      } else {
+        fmt.Println("\nuse '-m Cover' for cover")
       }
     }
     os.Exit(0)
   }
 
-  items := opf.GetItems()
+  items := render.Documents(files, book.Chapters)
   if len(items) < 1 {
     fmt.Printf(
       "Empty Epub, file %s has no items\n", epubPath,
@@ -220,6 +267,18 @@ func main() {
     os.Exit(0)
   }
 
+  if _, ok := opt['s']; ok {
+    broken := 0
+    for i := range items {
+      for _, d := range items[i].Diagnose() {
+        fmt.Println(d)
+        if d.Kind >= render.DiagRepaired {broken++}
+      }
+    }
+    if broken > 0 {os.Exit(1)}
+    os.Exit(0)
+  }
+
   optP, ok := opt['p']
   if ok && optP != "" {
     index = 0
@@ -229,16 +288,40 @@ func main() {
       }
     }
     if index < 1 {
-      open(optP)
+      tui.Open(files, optP)
       os.Exit(0)
     }
   }
 
-  (&EpubViewer{
+  // Books opened for the first time show their cover.
+  var cover *render.Picture
+  if config, _ := tui.GetConfig(); !config.Opened(epubPath) {
+    if href, _ := book.Cover(); href != "" && index == 0 && cursor == 0 {
+      cover = render.ReadPicture(files, href, "Cover")
+    }
+    config.SetOpened(epubPath)
+    config.Save()
+  }
+
+  (&tui.Viewer{
     Index: index,
     Cursor: cursor,
     FilePath: epubPath,
+    Files: files,
     EpubItems: items,
-    EPUBTitle: opf.Metadata.Title,
+    EPUBTitle: book.Title(),
+    Toc: book.Toc,
+    RTL: opf.Spine.Direction == "rtl",
+    Vertical: book.Vertical(),
+    Cover: cover,
+    Screen: render.NewScreen(render.DetectGraphics()),
   }).StartProgram()
 }
+
+func SaveTMP(r io.Reader, s string) error {
+  file, err := os.Create(s)
+  if err != nil {return err}
+  _, err = bufio.NewReader(r).WriteTo(file)
+  file.Close()
+  return err
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+  "testing"
+)
+
+func TestStrictFlag(t *testing.T) {
+  for _, args := range [][]string{
+    {"book.epub", "--strict"},
+    {"--strict", "book.epub"},
+    {"-sf", "book.epub"},
+    {"--strict", "-f", "book.epub"},
+  } {
+    opt := parseOpt(args)
+    if _, ok := opt['s']; !ok {t.Errorf("%q: not strict", args)}
+    path := opt['f']
+    if path == "" {path = firstArg(args)}
+    if path != "book.epub" {t.Errorf("%q: book %q", args, path)}
+  }
+  if got := firstArg([]string{"-i", "3", "book.epub"}); got != "book.epub" {
+    t.Errorf("book after a flag: %q", got)
+  }
+}
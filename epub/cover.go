@@ -0,0 +1,88 @@
+package epub
+
+import (
+  "strings"
+  "encoding/xml"
+)
+
+// Cover finds the cover image of the book and the page showing
+// it. The EPUB3 cover-image property comes first, then the EPUB2
+// cover meta, then the first image of the cover page named by the
+// landmarks or the guide.
+func (this *Book) Cover() (image, page string) {
+  opf := &this.OPF
+  var meta, nav string
+  for _, m := range opf.Metadata.MetaTags {
+    if m.Name == "cover" {meta = m.Content}
+  }
+  for _, item := range opf.Manifest.Items {
+    if HasToken(item.Properties, "cover-image") && image == "" {
+      image = item.Href
+    }
+    if HasToken(item.Properties, "nav") {nav = item.Href}
+  }
+  if image == "" && meta != "" {
+    for _, item := range opf.Manifest.Items {
+      if item.Id == meta && strings.HasPrefix(item.Type, "image/") {
+        image = item.Href
+      }
+    }
+  }
+
+  if nav != "" {page = ParseLandmark(this.Files, nav, "cover")}
+  for _, ref := range opf.Guide.References {
+    if page == "" && ref.Type == "cover" {
+      page = ResolveHref(opf.Base, ref.Href)
+    }
+  }
+  page = strings.Split(page, "#")[0]
+
+  if image == "" && page != "" {image = pageImage(this.Files, page)}
+  return
+}
+
+// ParseLandmark returns the target of the landmark of the given
+// kind in the navigation document, or "".
+func ParseLandmark(files Resources, href, kind string) string {
+  reader, err := files.Open(href)
+  if err != nil {return ""}
+  defer reader.Close()
+
+  d := NewDecoder(reader)
+  landmarks := false
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    token, ok := t.(xml.StartElement)
+    if !ok {continue}
+    switch token.Name.Local {
+      case "nav": {
+        landmarks = HasToken(AttrValue(token, "type"), "landmarks")
+      }
+      case "a": {
+        link := AttrValue(token, "href")
+        if landmarks && link != "" && HasToken(AttrValue(token, "type"), kind) {
+          return ResolveHref(href, link)
+        }
+      }
+    }
+  }
+  return ""
+}
+
+// pageImage returns the first image of an XHTML page, as an img
+// or an SVG image element.
+func pageImage(files Resources, href string) string {
+  reader, err := files.Open(href)
+  if err != nil {return ""}
+  defer reader.Close()
+
+  d := NewDecoder(reader)
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    token, ok := t.(xml.StartElement)
+    if !ok {continue}
+    switch token.Name.Local {
+      case "img": {return ResolveHref(href, AttrValue(token, "src"))}
+      case "image": {return ResolveHref(href, AttrValue(token, "href"))}
+    }
+  }
+  return ""
+}
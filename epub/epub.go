@@ -0,0 +1,216 @@
+// Package epub reads the container, package document, manifest,
+// spine and navigation of EPUB books.
+package epub
+
+import (
+  "io"
+  "os"
+  "errors"
+  "bytes"
+  "regexp"
+  "strings"
+  "encoding/xml"
+)
+
+const (
+  MimetypePath  = "mimetype"
+  ContainerPath = "META-INF/container.xml"
+  TypeXHTML     = "application/xhtml+xml"
+  TypeEPUB      = "application/epub+zip"
+  TypeCSS       = "text/css"
+)
+
+// Errors for books that cannot be opened.
+var (
+  ErrMimeType  = errors.New("invalid Epub file: bad mimetype")
+  ErrContainer = errors.New("invalid Epub file: bad container")
+  ErrPackage   = errors.New("invalid Epub file: bad package document")
+)
+
+var writingModeRe = regexp.MustCompile(
+  `(?i)writing-mode\s*:\s*(vertical-rl|tb-rl)`,
+)
+
+// Container is META-INF/container.xml, naming the package
+// documents of the book.
+type Container struct {
+  RootFiles struct {
+    Files []struct {
+      FullPath  string `xml:"full-path,attr"`
+    } `xml:"rootfile"`
+  } `xml:"rootfiles"`
+}
+
+// OPF is the package document, with the metadata, manifest and
+// spine of the book.
+type OPF struct {
+  XMLName xml.Name `xml:"package"`
+
+  Spine struct {
+    Toc   string `xml:"toc,attr"`
+    Direction string `xml:"page-progression-direction,attr"`
+    Items []struct {
+      Idref string `xml:"idref,attr"`
+    } `xml:"itemref"`
+  } `xml:"spine"`
+
+  Manifest struct {
+    Items []Item `xml:"item"`
+  } `xml:"manifest"`
+
+  Guide struct {
+    References []struct {
+      Type  string `xml:"type,attr"`
+      Href  string `xml:"href,attr"`
+    } `xml:"reference"`
+  } `xml:"guide"`
+
+  Metadata struct {
+    Title       string  `xml:"title"`
+    Rights      string  `xml:"rights"`
+    Language    string  `xml:"language"`
+    Publisher   string  `xml:"publisher"`
+    Creators  []string  `xml:"creator"`
+    MetaTags  []struct {
+      Name    string  `xml:"name,attr"`
+      Content string  `xml:"content,attr"`
+    } `xml:"meta"`
+  } `xml:"metadata"`
+
+  Base string  // directory of the package document
+}
+
+// Item is a file of the manifest. Href is its path in the book,
+// as resolved by ResolveHref.
+type Item struct {
+  Id    string `xml:"id,attr"`
+  Href  string `xml:"href,attr"`
+  Type  string `xml:"media-type,attr"`
+  Properties string `xml:"properties,attr"`
+}
+
+// Chapter is a document of the spine, in reading order.
+type Chapter struct {
+  Item
+  Lang  string  // language of the book
+}
+
+// Book is an EPUB publication, with the files it is read from.
+type Book struct {
+  Path      string
+  Files     Resources
+  OPF       OPF
+  Chapters  []Chapter
+  Toc       []*TocEntry
+}
+
+// Open reads the container and package document of the EPUB at
+// path, an archive or the directory it was unpacked into. The
+// archive stays open until Close.
+func Open(path string) (*Book, error) {
+  if info, err := os.Stat(path); err == nil && info.IsDir() {
+    book, err := New(Dir(path))
+    if err == nil {book.Path = path}
+    return book, err
+  }
+
+  files, err := OpenZip(path)
+  if err != nil {return nil, err}
+
+  book, err := New(files)
+  if err != nil {
+    files.Close()
+    return nil, err
+  }
+  book.Path = path
+  return book, nil
+}
+
+// New reads the container and package document of the book
+// whose files are given.
+func New(files Resources) (*Book, error) {
+  if err := VerifyMimeType(files); err != nil {return nil, err}
+  cont, err := ParseContainer(files)
+  if err != nil {return nil, err}
+  opf, err := ParseOPF(files, cont.RootFiles.Files[0].FullPath)
+  if err != nil {return nil, err}
+
+  book := &Book{Files: files, OPF: opf}
+  book.Chapters = opf.GetItems()
+  book.Toc = book.GetToc()
+  return book, nil
+}
+
+// Title returns the title of the book.
+func (this *Book) Title() string {return this.OPF.Metadata.Title}
+
+// Close closes the files of the book, if they need it.
+func (this *Book) Close() error {
+  if c, ok := this.Files.(io.Closer); ok {return c.Close()}
+  return nil
+}
+
+// VerifyMimeType checks the mimetype file of the book. Unpacked
+// books may have it end in a new line, as editors write files.
+func VerifyMimeType(files Resources) error {
+  c, err := ReadContent(files, MimetypePath)
+  if _, ok := files.(Dir); ok {c = bytes.TrimSpace(c)}
+  if err != nil || string(c) != TypeEPUB {return ErrMimeType}
+  return nil
+}
+
+func ParseContainer(files Resources) (c Container, err error) {
+  byt, err := ReadContent(files, ContainerPath)
+  if err == nil {err = xml.Unmarshal(byt, &c)}
+  if err != nil || c.RootFiles.Files == nil {return c, ErrContainer}
+  return c, nil
+}
+
+func ParseOPF(files Resources, href string) (opf OPF, err error) {
+  c, err := ReadContent(files, href)
+  if err == nil {err = NewDecoder(bytes.NewReader(c)).Decode(&opf)}
+  if err != nil {return opf, ErrPackage}
+
+  lastSlash := strings.LastIndex(href, "/")
+  opf.Base = href[:lastSlash + 1]
+  for i, item := range opf.Manifest.Items {
+    opf.Manifest.Items[i].Href = ResolveHref(opf.Base, item.Href)
+  }
+  return opf, nil
+}
+
+// GetItems returns the documents of the spine, or those of the
+// manifest for books without one.
+func (opf *OPF) GetItems() (
+  items []Chapter,
+) {
+  if len(opf.Spine.Items) == 0 {
+    for _, j := range opf.Manifest.Items {
+      if j.Type == TypeXHTML {
+        items = append(items, Chapter{j, opf.Metadata.Language})
+      }
+    }
+    return
+  }
+
+  for _, i := range opf.Spine.Items {
+    for _, j := range opf.Manifest.Items {
+      if i.Idref == j.Id {
+        items = append(items, Chapter{j, opf.Metadata.Language})
+      }
+    }
+  }
+  return
+}
+
+// Vertical reports whether the style sheets of the book set
+// vertical writing.
+func (this *Book) Vertical() bool {
+  opf := &this.OPF
+  for _, item := range opf.Manifest.Items {
+    if item.Type != TypeCSS {continue}
+    byt, err := ReadContent(this.Files, item.Href)
+    if err == nil && writingModeRe.Match(byt) {return true}
+  }
+  return false
+}
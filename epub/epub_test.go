@@ -0,0 +1,89 @@
+package epub
+
+import (
+  "os"
+  "testing"
+  "path/filepath"
+)
+
+// testBook is a book with a space in the name of a chapter and of
+// its cover, escaped in the package document.
+func testBook() Memory {
+  return Memory{
+    "mimetype": []byte("application/epub+zip"),
+    "META-INF/container.xml": []byte(`<container><rootfiles>
+      <rootfile full-path="OEBPS/content.opf"/></rootfiles></container>`),
+    "OEBPS/content.opf": []byte(`<package>
+      <metadata><title>Test</title><meta name="cover" content="img"/></metadata>
+      <manifest>
+        <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+        <item id="c1" href="text/ch%201.xhtml" media-type="application/xhtml+xml"/>
+        <item id="c2" href="text/ch2.xhtml" media-type="application/xhtml+xml"/>
+        <item id="img" href="images/the%20cover.png" media-type="image/png"/>
+      </manifest>
+      <spine><itemref idref="c1"/><itemref idref="c2"/></spine>
+    </package>`),
+    "OEBPS/nav.xhtml": []byte(`<html><body><nav epub:type="toc"><ol>
+      <li><a href="text/ch%201.xhtml#start">One</a></li>
+      <li><a href="text/ch2.xhtml">Two</a></li>
+    </ol></nav></body></html>`),
+    "OEBPS/text/ch 1.xhtml": []byte(`<html><body><p>One</p></body></html>`),
+    "OEBPS/text/ch2.xhtml": []byte(`<html><body><p>Two</p></body></html>`),
+    "OEBPS/images/the cover.png": []byte("png"),
+  }
+}
+
+func TestEscapedHrefs(t *testing.T) {
+  book, err := New(testBook())
+  if err != nil {t.Fatal(err)}
+  if len(book.Chapters) != 2 {t.Fatalf("%d chapters", len(book.Chapters))}
+
+  href := book.Chapters[0].Href
+  if href != "OEBPS/text/ch 1.xhtml" {t.Errorf("chapter href %q", href)}
+  if _, err := ReadContent(book.Files, href); err != nil {t.Error(err)}
+  if len(book.Toc) != 2 || book.Toc[0].Href != href + "#start" {
+    t.Errorf("toc %+v", book.Toc)
+  }
+  if image, _ := book.Cover(); image != "OEBPS/images/the cover.png" {
+    t.Errorf("cover %q", image)
+  }
+}
+
+func TestResolveHref(t *testing.T) {
+  tests := [][3]string{
+    {"OEBPS/text/a.xhtml", "b.xhtml", "OEBPS/text/b.xhtml"},
+    {"OEBPS/text/a.xhtml", "../images/a%20b.png", "OEBPS/images/a b.png"},
+    {"OEBPS/text/a.xhtml", "#note", "OEBPS/text/a.xhtml#note"},
+    {"OEBPS/text/a.xhtml#x", "#note", "OEBPS/text/a.xhtml#note"},
+    {"OEBPS/", "a.xhtml", "OEBPS/a.xhtml"},
+    {"", "a.xhtml", "a.xhtml"},
+    {"a.xhtml", "http://example.com/", "http://example.com/"},
+  }
+  for _, test := range tests {
+    if got := ResolveHref(test[0], test[1]); got != test[2] {
+      t.Errorf("ResolveHref(%q, %q) = %q, want %q", test[0], test[1], got, test[2])
+    }
+  }
+}
+
+func TestMimeType(t *testing.T) {
+  dir := t.TempDir()
+  os.WriteFile(filepath.Join(dir, MimetypePath), []byte(TypeEPUB + "\n"), 0666)
+  if err := VerifyMimeType(Dir(dir)); err != nil {t.Errorf("unpacked book: %v", err)}
+  zipped := Memory{MimetypePath: []byte(TypeEPUB + "\n")}
+  if VerifyMimeType(zipped) != ErrMimeType {t.Error("mimetype with a new line taken")}
+}
+
+func TestDirEscape(t *testing.T) {
+  root := t.TempDir()
+  dir := filepath.Join(root, "book")
+  os.MkdirAll(filepath.Join(dir, "OEBPS"), 0777)
+  os.WriteFile(filepath.Join(root, "secret"), []byte("x"), 0666)
+  os.WriteFile(filepath.Join(dir, "OEBPS", "a.xhtml"), []byte("a"), 0666)
+
+  if _, err := ReadContent(Dir(dir), "OEBPS/../OEBPS/a.xhtml"); err != nil {t.Error(err)}
+  for _, href := range []string{"../secret", "OEBPS/../../secret", "/etc/passwd"} {
+    if _, err := ReadContent(Dir(dir), href); err == nil {t.Errorf("%s read", href)}
+    if _, err := Extract(Dir(dir), href, root); err == nil {t.Errorf("%s extracted", href)}
+  }
+}
@@ -0,0 +1,116 @@
+package epub
+
+import (
+  "io"
+  "os"
+  "bytes"
+  "bufio"
+  "strings"
+  "io/fs"
+  "io/ioutil"
+  "path/filepath"
+  "archive/zip"
+)
+
+// Resources gives the files of a book by their path in it, as
+// found in the package document and resolved by ResolveHref.
+type Resources interface {
+  Open(href string) (io.ReadCloser, error)
+}
+
+// Zip holds the files of an EPUB archive.
+type Zip struct {
+  files  map[string]*zip.File
+  closer io.Closer
+}
+
+// NewZip gives the files of the archive read by r.
+func NewZip(r *zip.Reader) *Zip {
+  this := &Zip{files: map[string]*zip.File{}}
+  for _, file := range r.File {
+    this.files[file.Name] = file
+  }
+  return this
+}
+
+// OpenZip opens the archive at path, which stays open until
+// Close.
+func OpenZip(path string) (*Zip, error) {
+  reader, err := zip.OpenReader(path)
+  if err != nil {return nil, err}
+  this := NewZip(&reader.Reader)
+  this.closer = reader
+  return this, nil
+}
+
+func (this *Zip) Open(href string) (io.ReadCloser, error) {
+  if file, ok := this.files[href]; ok {return file.Open()}
+  return nil, notFound(href)
+}
+
+func (this *Zip) Close() error {
+  if this.closer == nil {return nil}
+  return this.closer.Close()
+}
+
+// Dir holds the files under a directory of the file system. The
+// empty Dir takes paths as they are, for XHTML files read on
+// their own.
+type Dir string
+
+func (this Dir) Open(href string) (io.ReadCloser, error) {
+  path, err := this.path(href)
+  if err != nil {return nil, err}
+  return os.Open(path)
+}
+
+// path is the file of href, which must not lead out of the
+// directory.
+func (this Dir) path(href string) (string, error) {
+  if this == "" {return filepath.FromSlash(href), nil}
+  rel := filepath.Clean(filepath.FromSlash(href))
+  if filepath.IsAbs(rel) || rel == ".." ||
+    strings.HasPrefix(rel, ".." + string(filepath.Separator)) {
+    return "", &fs.PathError{Op: "open", Path: href, Err: fs.ErrPermission}
+  }
+  return filepath.Join(string(this), rel), nil
+}
+
+// Memory holds files in memory, by path.
+type Memory map[string][]byte
+
+func (this Memory) Open(href string) (io.ReadCloser, error) {
+  if byt, ok := this[href]; ok {
+    return ioutil.NopCloser(bytes.NewReader(byt)), nil
+  }
+  return nil, notFound(href)
+}
+
+func notFound(href string) error {
+  return &fs.PathError{Op: "open", Path: href, Err: fs.ErrNotExist}
+}
+
+// ReadContent reads the file at href.
+func ReadContent(files Resources, href string) ([]byte, error) {
+  reader, err := files.Open(href)
+  if err != nil {return nil, err}
+  defer reader.Close()
+  return ioutil.ReadAll(reader)
+}
+
+// Extract returns a path of the file system holding the file at
+// href, copying it into dir unless it is there already.
+func Extract(files Resources, href, dir string) (string, error) {
+  if d, ok := files.(Dir); ok {return d.path(href)}
+
+  reader, err := files.Open(href)
+  if err != nil {return "", err}
+  defer reader.Close()
+
+  tmpSRC := filepath.Join(dir, filepath.Base(href))
+  file, err := os.Create(tmpSRC)
+  if err != nil {return "", err}
+  _, err = bufio.NewReader(reader).WriteTo(file)
+  file.Close()
+  return tmpSRC, err
+}
@@ -0,0 +1,175 @@
+package epub
+
+import (
+  "bytes"
+  "strings"
+  "encoding/xml"
+)
+
+type TocEntry struct {
+  Title     string
+  Href      string
+  Open      bool
+  Children  []*TocEntry
+}
+
+type TocLine struct {
+  Depth int
+  Entry *TocEntry
+}
+
+type ncxPoint struct {
+  Label   string  `xml:"navLabel>text"`
+  Content struct {
+    Src   string  `xml:"src,attr"`
+  } `xml:"content"`
+  Points  []ncxPoint `xml:"navPoint"`
+}
+
+type epubNCX struct {
+  Points []ncxPoint `xml:"navMap>navPoint"`
+}
+
+// GetToc builds the table of contents from the EPUB3 navigation
+// document, falling back to the EPUB2 NCX referenced by the spine.
+func (this *Book) GetToc() []*TocEntry {
+  opf := &this.OPF
+  var nav, ncx string
+  for _, item := range opf.Manifest.Items {
+    if HasToken(item.Properties, "nav") {
+      nav = item.Href
+    }
+    if opf.Spine.Toc != "" && item.Id == opf.Spine.Toc {
+      ncx = item.Href
+    }
+  }
+
+  if nav != "" {
+    if toc := ParseNav(this.Files, nav); len(toc) > 0 {return toc}
+  }
+  if ncx != "" {return ParseNCX(this.Files, ncx)}
+  return nil
+}
+
+func ParseNCX(files Resources, href string) []*TocEntry {
+  byt, err := ReadContent(files, href)
+  if err != nil {return nil}
+
+  var ncx epubNCX
+  if NewDecoder(bytes.NewReader(byt)).Decode(&ncx) != nil {return nil}
+
+  var convert func([]ncxPoint) []*TocEntry
+  convert = func(points []ncxPoint) (toc []*TocEntry) {
+    for _, p := range points {
+      toc = append(toc, &TocEntry{
+        Title: strings.TrimSpace(newLineRe.ReplaceAllString(p.Label, " ")),
+        Href: ResolveHref(href, p.Content.Src),
+        Children: convert(p.Points),
+      })
+    }
+    return
+  }
+  return convert(ncx.Points)
+}
+
+func ParseNav(files Resources, href string) []*TocEntry {
+  reader, err := files.Open(href)
+  if err != nil {return nil}
+  defer reader.Close()
+
+  d := NewDecoder(reader)
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    token, ok := t.(xml.StartElement)
+    if !ok || token.Name.Local != "nav" {continue}
+
+    if !HasToken(AttrValue(token, "type"), "toc") {
+      d.Skip()
+      continue
+    }
+    return parseNavList(d, href)
+  }
+  return nil
+}
+
+// parseNavList reads entries of the first <ol> until the end of
+// the element the decoder is currently in.
+func parseNavList(d *xml.Decoder, href string) (toc []*TocEntry) {
+  depth := 0
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    switch token := t.(type) {
+      case xml.StartElement: {
+        if token.Name.Local == "li" {
+          toc = append(toc, parseNavItem(d, href))
+          continue
+        }
+        depth++
+      }
+      case xml.EndElement: {
+        if depth == 0 {return}
+        depth--
+      }
+    }
+  }
+  return
+}
+
+func parseNavItem(d *xml.Decoder, href string) *TocEntry {
+  entry := &TocEntry{}
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    switch token := t.(type) {
+      case xml.StartElement: {
+        switch token.Name.Local {
+          case "a", "span": {
+            if link := AttrValue(token, "href"); link != "" {
+              entry.Href = ResolveHref(href, link)
+            }
+            entry.Title = InnerText(d)
+          }
+          case "ol": {
+            entry.Children = parseNavList(d, href)
+          }
+          default: {d.Skip()}
+        }
+      }
+      case xml.EndElement: {return entry}
+    }
+  }
+  return entry
+}
+
+// TocLines flattens the expanded part of the tree for display.
+func TocLines(toc []*TocEntry, depth int) (lines []TocLine) {
+  for _, e := range toc {
+    lines = append(lines, TocLine{depth, e})
+    if e.Open {
+      lines = append(lines, TocLines(e.Children, depth + 1)...)
+    }
+  }
+  return
+}
+
+// TocFind returns the path of entries leading to the last entry
+// pointing into href at or before the cursor.
+func TocFind(
+  toc []*TocEntry, href string, anchors map[string]int, cursor int,
+) (path []*TocEntry) {
+  best := -1
+  var walk func([]*TocEntry, []*TocEntry)
+  walk = func(toc []*TocEntry, parents []*TocEntry) {
+    for _, e := range toc {
+      cur := append(parents[:len(parents):len(parents)], e)
+      split := strings.SplitN(e.Href, "#", 2)
+      if split[0] == href {
+        o, ok := 0, true
+        if len(split) > 1 {o, ok = anchors[split[1]]}
+        if ok && o <= cursor && o > best {
+          best = o
+          path = cur
+        }
+      }
+      walk(e.Children, cur)
+    }
+  }
+  walk(toc, nil)
+  return
+}
@@ -0,0 +1,85 @@
+package epub
+
+import "io"
+import "path"
+import "regexp"
+import "net/url"
+import "strings"
+import "encoding/xml"
+
+var absoluteRe *regexp.Regexp = regexp.MustCompile(
+  `^([^:/]+:/)?/`,
+)
+
+var newLineRe *regexp.Regexp = regexp.MustCompile(
+  `[\s\t]*\n[\s\t]*`,
+)
+
+// ResolveHref resolves link relative to the document base,
+// keeping any fragment.
+func ResolveHref(base, link string) string {
+  if absoluteRe.MatchString(link) {return link}
+  if u, err := url.PathUnescape(link); err == nil {link = u}
+  if strings.HasPrefix(link, "#") {
+    return strings.Split(base, "#")[0] + link
+  }
+
+  lastSlash := strings.LastIndex(base, "/")
+  return path.Clean(base[:lastSlash + 1] + link)
+}
+
+// VoidElements are the HTML elements that have no end tag.
+var VoidElements = []string{
+  "area", "base", "basefont", "br", "col", "embed", "frame", "hr",
+  "img", "input", "isindex", "keygen", "link", "meta", "param",
+  "source", "track", "wbr",
+}
+
+// NewDecoder returns a decoder that reads XHTML as browsers do,
+// taking HTML entities, void elements written without a slash,
+// stray ampersands and end tags that do not match.
+func NewDecoder(r io.Reader) *xml.Decoder {
+  d := xml.NewDecoder(r)
+  d.Strict = false
+  d.AutoClose = VoidElements
+  d.Entity = htmlEntities
+  return d
+}
+
+// AttrValue returns the attribute of the element with the local
+// name, or "".
+func AttrValue(token xml.StartElement, name string) string {
+  for _, attr := range token.Attr {
+    if attr.Name.Local == name {return attr.Value}
+  }
+  return ""
+}
+
+// HasToken reports whether the space separated list s contains tok,
+// as used by properties and epub:type attributes.
+func HasToken(s, tok string) bool {
+  for _, v := range strings.Fields(s) {
+    if v == tok {return true}
+  }
+  return false
+}
+
+// InnerText collects the character data up to the end of the
+// element the decoder is currently in.
+func InnerText(d *xml.Decoder) string {
+  var text string
+  depth := 0
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    switch token := t.(type) {
+      case xml.CharData: {text += string(token)}
+      case xml.StartElement: {depth++}
+      case xml.EndElement: {
+        if depth == 0 {
+          return strings.TrimSpace(newLineRe.ReplaceAllString(text, " "))
+        }
+        depth--
+      }
+    }
+  }
+  return strings.TrimSpace(newLineRe.ReplaceAllString(text, " "))
+}
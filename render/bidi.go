@@ -0,0 +1,498 @@
+package render
+
+import (
+  "sort"
+  "unicode"
+)
+
+// Bidirectional character types of UAX #9.
+const (
+  bdL = iota  // left to right
+  bdR         // right to left
+  bdAL        // Arabic letter
+  bdEN        // European number
+  bdES        // European separator
+  bdET        // European terminator
+  bdAN        // Arabic number
+  bdCS        // common separator
+  bdNSM       // non-spacing mark
+  bdBN        // boundary neutral
+  bdB         // paragraph separator
+  bdS         // segment separator
+  bdWS        // white space
+  bdON        // other neutrals
+  bdLRE
+  bdLRO
+  bdRLE
+  bdRLO
+  bdPDF
+  bdLRI
+  bdRLI
+  bdFSI
+  bdPDI
+)
+
+const maxBidiDepth = 125
+
+func bidiClass(r rune) int {
+  switch r {
+    case 0x202A: {return bdLRE}
+    case 0x202B: {return bdRLE}
+    case 0x202C: {return bdPDF}
+    case 0x202D: {return bdLRO}
+    case 0x202E: {return bdRLO}
+    case 0x2066: {return bdLRI}
+    case 0x2067: {return bdRLI}
+    case 0x2068: {return bdFSI}
+    case 0x2069: {return bdPDI}
+    case 0x200E: {return bdL}
+    case 0x200F: {return bdR}
+    case 0x061C: {return bdAL}
+    case '\n', '\r', 0x1C, 0x1D, 0x1E, 0x85, 0x2029: {return bdB}
+    case '\t', 0x0B, 0x1F: {return bdS}
+    case ' ', 0x0C, 0x2028: {return bdWS}
+    case '+', '-', 0x207A, 0x207B, 0x208A, 0x208B, 0x2212, 0xFB29,
+      0xFE62, 0xFE63, 0xFF0B, 0xFF0D: {
+      return bdES
+    }
+    case '#', '$', '%', 0x00A2, 0x00A3, 0x00A4, 0x00A5, 0x00B0, 0x00B1,
+      0x066A, 0x2030, 0x2031, 0x2032, 0x2033, 0x2034, 0x212E: {
+      return bdET
+    }
+    case ',', '.', '/', ':', 0x00A0, 0x060C, 0x202F, 0x2044, 0xFE50,
+      0xFE52, 0xFE55, 0xFF0C, 0xFF0E, 0xFF0F, 0xFF1A: {
+      return bdCS
+    }
+    case 0x066B, 0x066C: {return bdAN}
+  }
+
+  switch {
+    case r >= '0' && r <= '9', r >= 0x06F0 && r <= 0x06F9,
+      r == 0x2070, r >= 0x2074 && r <= 0x2079,
+      r == 0x00B2, r == 0x00B3, r == 0x00B9,
+      r >= 0x2080 && r <= 0x2089, r >= 0xFF10 && r <= 0xFF19: {
+      return bdEN
+    }
+    case r >= 0x0660 && r <= 0x0669, r >= 0x0600 && r <= 0x0605,
+      r == 0x06DD, r == 0x08E2, r >= 0x10E60 && r <= 0x10E7E: {
+      return bdAN
+    }
+    case unicode.In(r, unicode.Mn, unicode.Me): {return bdNSM}
+    case r >= 0x0590 && r <= 0x05FF, r >= 0x07C0 && r <= 0x085F,
+      r >= 0xFB1D && r <= 0xFB4F, r >= 0x10800 && r <= 0x10CFF,
+      r >= 0x10D40 && r <= 0x10EBF, r >= 0x10F00 && r <= 0x10F2F,
+      r >= 0x1E800 && r <= 0x1EC6F: {
+      return bdR
+    }
+    case r >= 0x0600 && r <= 0x07BF, r >= 0x0860 && r <= 0x08FF,
+      r >= 0xFB50 && r <= 0xFDFF, r >= 0xFE70 && r <= 0xFEFE,
+      r >= 0x10D00 && r <= 0x10D3F, r >= 0x10F30 && r <= 0x10F6F,
+      r >= 0x1EC70 && r <= 0x1EEFF: {
+      return bdAL
+    }
+    case unicode.Is(unicode.Sc, r): {return bdET}
+    case unicode.Is(unicode.Cf, r), unicode.Is(unicode.Cc, r): {return bdBN}
+    case unicode.Is(unicode.Zs, r): {return bdWS}
+    case unicode.In(r, unicode.L, unicode.Mc, unicode.Nd, unicode.Nl): {
+      return bdL
+    }
+  }
+  return bdON
+}
+
+func isolateInitiator(c int) bool {
+  return c == bdLRI || c == bdRLI || c == bdFSI
+}
+
+// neutral reports whether c is a neutral or isolate formatting
+// type resolved by rules N1 and N2.
+func neutral(c int) bool {
+  return c == bdB || c == bdS || c == bdWS || c == bdON ||
+    isolateInitiator(c) || c == bdPDI
+}
+
+// paragraphLevel finds the first strong type outside isolates,
+// as in rules P2 and P3, returning -1 when there is none.
+func paragraphLevel(classes []int) int {
+  isolates := 0
+  for _, c := range classes {
+    switch {
+      case isolateInitiator(c): {isolates++}
+      case c == bdPDI: {
+        if isolates > 0 {isolates--}
+      }
+      case isolates > 0: {}
+      case c == bdL: {return 0}
+      case c == bdR, c == bdAL: {return 1}
+    }
+  }
+  return -1
+}
+
+// bidiLevels resolves the embedding level of each character of a
+// paragraph with the given types and runes. Isolating run sequences are
+// approximated by level runs, which only matters for text
+// spanning isolates. classes is rewritten with the resolved types.
+func bidiLevels(classes []int, runes []rune, base int) []int {
+  levels := make([]int, len(classes))
+  original := append([]int(nil), classes...)
+
+  // X1 to X8: explicit embeddings, overrides and isolates.
+  type entry struct {
+    level    int
+    override int
+    isolate  bool
+  }
+  stack := []entry{{level: base, override: -1}}
+  overflow, overflowEmbed, valid := 0, 0, 0
+  for i, c := range classes {
+    top := stack[len(stack) - 1]
+    switch c {
+      case bdRLE, bdLRE, bdRLO, bdLRO, bdRLI, bdLRI, bdFSI: {
+        isolate := isolateInitiator(c)
+        rtl := c == bdRLE || c == bdRLO || c == bdRLI
+        if c == bdFSI {
+          rtl = paragraphLevel(classes[i + 1:matchingPDI(classes, i)]) == 1
+        }
+        if isolate {
+          levels[i] = top.level
+          if top.override >= 0 {classes[i] = top.override}
+        } else {
+          levels[i] = top.level
+          classes[i] = bdBN
+        }
+
+        level := top.level + 1 + top.level % 2
+        if rtl {level = top.level + 1 + (top.level + 1) % 2}
+        if level <= maxBidiDepth && overflow == 0 && overflowEmbed == 0 {
+          e := entry{level: level, override: -1, isolate: isolate}
+          if c == bdRLO {e.override = bdR}
+          if c == bdLRO {e.override = bdL}
+          if isolate {valid++}
+          stack = append(stack, e)
+        } else if isolate {
+          overflow++
+        } else if overflow == 0 {
+          overflowEmbed++
+        }
+      }
+      case bdPDI: {
+        if overflow > 0 {
+          overflow--
+        } else if valid > 0 {
+          overflowEmbed = 0
+          for !stack[len(stack) - 1].isolate {stack = stack[:len(stack) - 1]}
+          stack = stack[:len(stack) - 1]
+          valid--
+        }
+        top = stack[len(stack) - 1]
+        levels[i] = top.level
+        if top.override >= 0 {classes[i] = top.override}
+      }
+      case bdPDF: {
+        if overflow == 0 {
+          if overflowEmbed > 0 {
+            overflowEmbed--
+          } else if !top.isolate && len(stack) > 1 {
+            stack = stack[:len(stack) - 1]
+          }
+        }
+        levels[i] = top.level
+        classes[i] = bdBN
+      }
+      case bdB: {levels[i] = base}
+      case bdBN: {levels[i] = top.level}
+      default: {
+        levels[i] = top.level
+        if top.override >= 0 {classes[i] = top.override}
+      }
+    }
+  }
+
+  // X10: resolve each run of one level on its own.
+  for start := 0; start < len(classes); {
+    end := start
+    for end < len(classes) && levels[end] == levels[start] {end++}
+
+    prev, next := base, base
+    if start > 0 {prev = levels[start - 1]}
+    if end < len(classes) {next = levels[end]}
+    level := levels[start]
+    if level > prev {prev = level}
+    if level > next {next = level}
+    sos, eos := bdL, bdL
+    if prev % 2 == 1 {sos = bdR}
+    if next % 2 == 1 {eos = bdR}
+
+    resolveRun(classes[start:end], runes[start:end], level, sos, eos)
+    for i := start; i < end; i++ {
+      c := classes[i]
+      switch {
+        case level % 2 == 0 && c == bdR: {levels[i]++}
+        case level % 2 == 0 && (c == bdAN || c == bdEN): {levels[i] += 2}
+        case level % 2 == 1 && (c == bdL || c == bdEN || c == bdAN): {
+          levels[i]++
+        }
+      }
+    }
+    start = end
+  }
+
+  // L1: separators and the white space before them go back to
+  // the paragraph level.
+  trailing := true
+  for i := len(original) - 1; i >= 0; i-- {
+    c := original[i]
+    switch {
+      case c == bdB || c == bdS: {
+        levels[i] = base
+        trailing = true
+      }
+      case trailing && (c == bdWS || c == bdBN || isolateInitiator(c) ||
+        c == bdPDI): {
+        levels[i] = base
+      }
+      default: {trailing = false}
+    }
+  }
+  return levels
+}
+
+func matchingPDI(classes []int, i int) int {
+  depth := 0
+  for j := i + 1; j < len(classes); j++ {
+    switch {
+      case isolateInitiator(classes[j]): {depth++}
+      case classes[j] == bdPDI: {
+        if depth == 0 {return j}
+        depth--
+      }
+    }
+  }
+  return len(classes)
+}
+
+// resolveRun applies the weak type rules W1 to W7 and the neutral
+// type rules N0 to N2 to a run of characters of one level.
+func resolveRun(classes []int, runes []rune, level, sos, eos int) {
+  n := len(classes)
+  original := append([]int(nil), classes...)
+
+  // W1: marks take the type of what they follow.
+  prev := sos
+  for i, c := range classes {
+    switch {
+      case c == bdNSM: {
+        if isolateInitiator(prev) || prev == bdPDI {
+          classes[i] = bdON
+        } else {
+          classes[i] = prev
+        }
+      }
+      case c != bdBN: {prev = c}
+    }
+  }
+
+  // W2 and W3: numbers after Arabic letters are Arabic numbers.
+  strong := sos
+  for i, c := range classes {
+    switch c {
+      case bdL, bdR: {strong = c}
+      case bdAL: {
+        strong = c
+        classes[i] = bdR
+      }
+      case bdEN: {
+        if strong == bdAL {classes[i] = bdAN}
+      }
+    }
+  }
+
+  // W4: a single separator between two numbers of the same type.
+  for i := 1; i + 1 < n; i++ {
+    c, a, b := classes[i], classes[i - 1], classes[i + 1]
+    switch {
+      case c == bdES && a == bdEN && b == bdEN: {classes[i] = bdEN}
+      case c == bdCS && a == bdEN && b == bdEN: {classes[i] = bdEN}
+      case c == bdCS && a == bdAN && b == bdAN: {classes[i] = bdAN}
+    }
+  }
+
+  // W5: terminators next to European numbers.
+  for i := 0; i < n; i++ {
+    if classes[i] != bdET && classes[i] != bdBN {continue}
+    j := i
+    for j < n && (classes[j] == bdET || classes[j] == bdBN) {j++}
+    if i > 0 && classes[i - 1] == bdEN || j < n && classes[j] == bdEN {
+      for k := i; k < j; k++ {classes[k] = bdEN}
+    }
+    i = j
+  }
+
+  // W6 and W7.
+  strong = sos
+  for i, c := range classes {
+    switch c {
+      case bdES, bdET, bdCS: {classes[i] = bdON}
+      case bdL, bdR: {strong = c}
+      case bdEN: {
+        if strong == bdL {classes[i] = bdL}
+      }
+    }
+  }
+
+  embedding := bdL
+  if level % 2 == 1 {embedding = bdR}
+  strongOf := func(c int) int {
+    if c == bdEN || c == bdAN {return bdR}
+    return c
+  }
+
+  // N0: brackets of a pair take the direction of the text in
+  // them, that of the embedding when it is found there, else the
+  // other when the text before the pair has it too.
+  for _, pair := range bracketPairs(classes, runes) {
+    inside := -1
+    for k := pair[0] + 1; k < pair[1]; k++ {
+      c := strongOf(classes[k])
+      if c != bdL && c != bdR {continue}
+      inside = c
+      if c == embedding {break}
+    }
+    if inside < 0 {continue}
+    dir := embedding
+    if inside != embedding {
+      before := sos
+      for k := pair[0] - 1; k >= 0; k-- {
+        if c := strongOf(classes[k]); c == bdL || c == bdR {
+          before = c
+          break
+        }
+      }
+      if before == inside {dir = inside}
+    }
+    for _, at := range pair {
+      classes[at] = dir
+      for k := at + 1; k < n && (original[k] == bdNSM || original[k] == bdBN); k++ {
+        if original[k] == bdNSM {classes[k] = dir}
+      }
+    }
+  }
+
+  // N1 and N2: neutrals between text of one direction take it,
+  // numbers counting as right to left; others take the level's.
+  for i := 0; i < n; i++ {
+    if !neutral(classes[i]) && classes[i] != bdBN {continue}
+    j := i
+    for j < n && (neutral(classes[j]) || classes[j] == bdBN) {j++}
+
+    before, after := sos, eos
+    if i > 0 {before = strongOf(classes[i - 1])}
+    if j < n {after = strongOf(classes[j])}
+    dir := embedding
+    if before == after {dir = before}
+    for k := i; k < j; k++ {classes[k] = dir}
+    i = j
+  }
+}
+
+// bracketPairs finds the pairs of brackets of a run as in rule
+// BD16, in the order of their opening brackets.
+func bracketPairs(classes []int, runes []rune) (pairs [][2]int) {
+  type opening struct {
+    close rune
+    at    int
+  }
+  var stack []opening
+  for i, r := range runes {
+    if classes[i] != bdON {continue}
+    if c, ok := pairedBrackets[r]; ok {
+      if len(stack) == 63 {break}
+      stack = append(stack, opening{c, i})
+      continue
+    }
+    if r == 0x232A {r = 0x3009}
+    for j := len(stack) - 1; j >= 0; j-- {
+      if stack[j].close == r {
+        pairs = append(pairs, [2]int{stack[j].at, i})
+        stack = stack[:j]
+        break
+      }
+    }
+  }
+  sort.Slice(pairs, func(i, j int) bool {return pairs[i][0] < pairs[j][0]})
+  return
+}
+
+// pairedBrackets maps the opening brackets of Unicode to their
+// closing ones, taking U+2329 as its equivalent U+3008.
+var pairedBrackets = map[rune]rune{
+  '(': ')', '[': ']', '{': '}', 0x2329: 0x3009,
+  0xFF3B: 0xFF3D, 0xFF5B: 0xFF5D,
+}
+
+func init() {
+  // Runs of brackets opened and closed by adjacent code points.
+  for _, r := range [][2]rune{
+    {0x0F3A, 0x0F3D}, {0x169B, 0x169C}, {0x2045, 0x2046},
+    {0x207D, 0x207E}, {0x208D, 0x208E}, {0x2308, 0x230B},
+    {0x2768, 0x2775}, {0x27C5, 0x27C6}, {0x27E6, 0x27EF},
+    {0x2983, 0x2998}, {0x29D8, 0x29DB}, {0x29FC, 0x29FD},
+    {0x2E22, 0x2E29}, {0x2E55, 0x2E5C}, {0x3008, 0x3011},
+    {0x3014, 0x301B}, {0xFE59, 0xFE5E}, {0xFF08, 0xFF09},
+    {0xFF5F, 0xFF60}, {0xFF62, 0xFF63},
+  } {
+    for c := r[0]; c < r[1]; c += 2 {pairedBrackets[c] = c + 1}
+  }
+}
+
+// visualOrder returns the indexes of a line in the order they are
+// displayed, reversing runs from the highest level down (L2).
+func visualOrder(levels []int) []int {
+  order := make([]int, len(levels))
+  high, low := 0, maxBidiDepth + 2
+  for i, l := range levels {
+    order[i] = i
+    if l > high {high = l}
+    if l % 2 == 1 && l < low {low = l}
+  }
+
+  for level := high; level >= low; level-- {
+    for i := 0; i < len(levels); {
+      if levels[order[i]] < level {
+        i++
+        continue
+      }
+      j := i
+      for j < len(levels) && levels[order[j]] >= level {j++}
+      for a, b := i, j - 1; a < b; a, b = a + 1, b - 1 {
+        order[a], order[b] = order[b], order[a]
+      }
+      i = j
+    }
+  }
+  return order
+}
+
+var bidiMirrors = map[rune]rune{
+  '(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{',
+  '<': '>', '>': '<', 0x00AB: 0x00BB, 0x00BB: 0x00AB,
+  0x2039: 0x203A, 0x203A: 0x2039, 0x2264: 0x2265, 0x2265: 0x2264,
+  0x3008: 0x3009, 0x3009: 0x3008, 0x300A: 0x300B, 0x300B: 0x300A,
+  0x300C: 0x300D, 0x300D: 0x300C, 0x300E: 0x300F, 0x300F: 0x300E,
+  0x3010: 0x3011, 0x3011: 0x3010, 0xFF08: 0xFF09, 0xFF09: 0xFF08,
+}
+
+// textDir tells the direction of a paragraph from its first
+// strong character, "" when it has none.
+func textDir(s string) string {
+  var classes []int
+  for _, r := range sgrRe.ReplaceAllString(s, "") {
+    classes = append(classes, bidiClass(r))
+  }
+  switch paragraphLevel(classes) {
+    case 0: {return "ltr"}
+    case 1: {return "rtl"}
+  }
+  return ""
+}
@@ -0,0 +1,41 @@
+package render
+
+import (
+  "testing"
+)
+
+func TestBidiReorder(t *testing.T) {
+  tests := []struct {
+    dir, text, want string
+  }{
+    {"", "hello world", "hello world"},
+    {"", "שלום עולם", "םלוע םולש"},
+    {"", "abc שלום def", "abc םולש def"},
+    {"", "שלום abc def סוף", "ףוס abc def םולש"},
+    {"", "שלום 123 סוף", "ףוס 123 םולש"},
+    {"", "שלום עולם (abc) 123 סוף", "ףוס 123 (abc) םלוע םולש"},
+    {"", "שלום [עולם] סוף", "ףוס [םלוע] םולש"},
+    {"", "abc (שלום) def", "abc (םולש) def"},
+    {"", "abc (שלום def) ghi", "abc (םולש def) ghi"},
+    {"", "שלום (abc עולם) סוף", "ףוס (םלוע abc) םולש"},
+    {"", "سلام (abc) عالم", "ملاع (abc) مالس"},
+    {"rtl", "abc (def)", "abc (def)"},
+    {"rtl", "(abc) שלום", "םולש (abc)"},
+    {"", "a (b) שלום", "a (b) םולש"},
+  }
+  for _, test := range tests {
+    lines := Wrap{Width: 80, Dir: test.dir}.Lines(test.text)
+    if len(lines) != 1 || stripEscapes(lines[0]) != test.want {
+      t.Errorf("%q: got %q, want %q", test.text, lines, test.want)
+    }
+  }
+}
+
+func TestTextDir(t *testing.T) {
+  for s, want := range map[string]string{
+    "hello": "ltr", "שלום hello": "rtl", "123 שלום": "rtl",
+    "\x1b[1mשלום\x1b[22m": "rtl", "123 ...": "",
+  } {
+    if got := textDir(s); got != want {t.Errorf("%q: %q, want %q", s, got, want)}
+  }
+}
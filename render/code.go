@@ -0,0 +1,88 @@
+package render
+
+import (
+  "strings"
+  "encoding/xml"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+const TabSize = 8
+
+type Code struct {
+  Lang  string
+  Lines []string
+}
+
+// ReadCode consumes a <pre> element keeping its whitespace and
+// line breaks as they are.
+func ReadCode(d *xml.Decoder, token xml.StartElement) *Code {
+  code := &Code{Lang: codeLang(token)}
+  var text strings.Builder
+  depth := 0
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    switch token := t.(type) {
+      case xml.CharData: {text.Write(token)}
+      case xml.StartElement: {
+        depth++
+        if token.Name.Local == "br" {text.WriteString("\n")}
+        if code.Lang == "" {code.Lang = codeLang(token)}
+      }
+      case xml.EndElement: {
+        depth--
+      }
+    }
+    if depth < 0 {break}
+  }
+
+  src := strings.TrimPrefix(text.String(), "\n")
+  src = strings.TrimRight(src, "\n\t ")
+  src = strings.ReplaceAll(src, "\r\n", "\n")
+  lines := strings.Split(src, "\n")
+  for i, v := range lines {lines[i] = expandTabs(v)}
+  code.Lines = Highlight(code.Lang, strings.Join(lines, "\n"))
+  return code
+}
+
+// codeLang reads the language from class names such as
+// "language-go" or "lang-py".
+func codeLang(token xml.StartElement) string {
+  for _, v := range strings.Fields(epub.AttrValue(token, "class")) {
+    for _, prefix := range []string{"language-", "lang-"} {
+      if strings.HasPrefix(v, prefix) {
+        return strings.ToLower(v[len(prefix):])
+      }
+    }
+  }
+  return ""
+}
+
+func expandTabs(s string) string {
+  if !strings.Contains(s, "\t") {return s}
+  var res strings.Builder
+  col := 0
+  for _, r := range s {
+    if r == '\t' {
+      n := TabSize - col % TabSize
+      res.WriteString(strings.Repeat(" ", n))
+      col += n
+      continue
+    }
+    res.WriteRune(r)
+    col++
+  }
+  return res.String()
+}
+
+// Render draws the code behind a rule, clipping lines that do not
+// fit instead of wrapping them.
+func (this *Code) Render(width int) (lines []string) {
+  w := width - 2
+  for _, v := range this.Lines {
+    if TextWidth(v) > w {
+      v = Clip(v, w - 1) + colorReset + "\x1b[2m›\x1b[22m"
+    }
+    lines = append(lines, "\x1b[2m│\x1b[22m " + v)
+  }
+  return
+}
@@ -0,0 +1,110 @@
+package render
+
+import (
+  "strings"
+  "encoding/xml"
+)
+
+var superscripts = map[rune]rune{
+  '0': '⁰', '1': '¹', '2': '²', '3': '³', '4': '⁴',
+  '5': '⁵', '6': '⁶', '7': '⁷', '8': '⁸', '9': '⁹',
+  '+': '⁺', '-': '⁻', '−': '⁻', '=': '⁼', '(': '⁽', ')': '⁾',
+  'a': 'ᵃ', 'b': 'ᵇ', 'c': 'ᶜ', 'd': 'ᵈ', 'e': 'ᵉ', 'f': 'ᶠ',
+  'g': 'ᵍ', 'h': 'ʰ', 'i': 'ⁱ', 'j': 'ʲ', 'k': 'ᵏ', 'l': 'ˡ',
+  'm': 'ᵐ', 'n': 'ⁿ', 'o': 'ᵒ', 'p': 'ᵖ', 'r': 'ʳ', 's': 'ˢ',
+  't': 'ᵗ', 'u': 'ᵘ', 'v': 'ᵛ', 'w': 'ʷ', 'x': 'ˣ', 'y': 'ʸ',
+  'z': 'ᶻ',
+  'A': 'ᴬ', 'B': 'ᴮ', 'D': 'ᴰ', 'E': 'ᴱ', 'G': 'ᴳ', 'H': 'ᴴ',
+  'I': 'ᴵ', 'J': 'ᴶ', 'K': 'ᴷ', 'L': 'ᴸ', 'M': 'ᴹ', 'N': 'ᴺ',
+  'O': 'ᴼ', 'P': 'ᴾ', 'R': 'ᴿ', 'T': 'ᵀ', 'U': 'ᵁ', 'V': 'ⱽ',
+  'W': 'ᵂ',
+  'α': 'ᵅ', 'β': 'ᵝ', 'γ': 'ᵞ', 'δ': 'ᵟ', 'ε': 'ᵋ', 'θ': 'ᶿ',
+  'ι': 'ᶥ', 'φ': 'ᵠ', 'χ': 'ᵡ',
+}
+
+var subscripts = map[rune]rune{
+  '0': '₀', '1': '₁', '2': '₂', '3': '₃', '4': '₄',
+  '5': '₅', '6': '₆', '7': '₇', '8': '₈', '9': '₉',
+  '+': '₊', '-': '₋', '−': '₋', '=': '₌', '(': '₍', ')': '₎',
+  'a': 'ₐ', 'e': 'ₑ', 'h': 'ₕ', 'i': 'ᵢ', 'j': 'ⱼ', 'k': 'ₖ',
+  'l': 'ₗ', 'm': 'ₘ', 'n': 'ₙ', 'o': 'ₒ', 'p': 'ₚ', 'r': 'ᵣ',
+  's': 'ₛ', 't': 'ₜ', 'u': 'ᵤ', 'v': 'ᵥ', 'x': 'ₓ', 'ə': 'ₔ',
+  'β': 'ᵦ', 'γ': 'ᵧ', 'ρ': 'ᵨ', 'φ': 'ᵩ', 'χ': 'ᵪ',
+}
+
+// script is a sup or sub element being read, with where its
+// text starts in the content.
+type script struct {
+  sup   bool
+  para  int
+  at    int
+}
+
+// scriptText sets s in super- or subscript characters. When one
+// of them has no such form, it is written as ^(s) or _(s)
+// instead. Escape sequences and link marks are kept as they are.
+func scriptText(s string, sup bool) string {
+  forms, mark := subscripts, "_"
+  if sup {forms, mark = superscripts, "^"}
+
+  plain := LinkRe.ReplaceAllString(sgrRe.ReplaceAllString(s, ""), "")
+  if strings.TrimSpace(plain) == "" {return s}
+  for _, r := range plain {
+    if _, ok := forms[r]; !ok && r != ' ' {
+      if len([]rune(strings.TrimSpace(plain))) == 1 {return mark + s}
+      return mark + "(" + s + ")"
+    }
+  }
+
+  var res strings.Builder
+  for s != "" {
+    loc := sgrRe.FindStringIndex(s)
+    if l := LinkRe.FindStringIndex(s); l != nil && (loc == nil || l[0] < loc[0]) {
+      loc = l
+    }
+    text := s
+    if loc != nil {text = s[:loc[0]]}
+    for _, r := range text {
+      if f, ok := forms[r]; ok {r = f}
+      res.WriteRune(r)
+    }
+    if loc == nil {break}
+    res.WriteString(s[loc[0]:loc[1]])
+    s = s[loc[1]:]
+  }
+  return res.String()
+}
+
+// endScript converts the text written since the innermost sup
+// or sub element started, unless it has spanned paragraphs.
+func (this *Document) endScript() {
+  n := len(this.scripts)
+  if n == 0 {return}
+  s := this.scripts[n - 1]
+  this.scripts = this.scripts[:n - 1]
+
+  text := this.content[s.para]
+  if s.para != this.Offset || s.at > len(text) {return}
+  this.content[s.para] = text[:s.at] + scriptText(text[s.at:], s.sup)
+}
+
+// convertScript reads the text of the sup or sub element the
+// decoder has just entered, including that of nested elements.
+func convertScript(d *xml.Decoder, sup bool) string {
+  var text strings.Builder
+  depth := 0
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    switch token := t.(type) {
+      case xml.CharData: {text.Write(token)}
+      case xml.StartElement: {depth++}
+      case xml.EndElement: {depth--}
+    }
+    if depth < 0 {break}
+  }
+  s := newLineRe.ReplaceAllString(text.String(), " ")
+  return scriptText(s, sup)
+}
+
+func convertSUB(d *xml.Decoder) string {return convertScript(d, false)}
+
+func convertSUP(d *xml.Decoder) string {return convertScript(d, true)}
@@ -0,0 +1,463 @@
+package render
+
+import (
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+  "encoding/xml"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+// cssRule is a selector of a style sheet with its declarations,
+// in the order the sheets give them.
+type cssRule struct {
+  parts       []cssCompound  // ancestors first, the element last
+  specificity int
+  decls       []cssDecl
+}
+
+// cssCompound matches one element by its name, id and classes.
+type cssCompound struct {
+  name    string
+  id      string
+  classes []string
+}
+
+type cssDecl struct {
+  prop      string
+  value     string
+  important bool
+}
+
+// cssStyle is the part of an element's computed style that levt
+// can render.
+type cssStyle struct {
+  display    string
+  bold       bool
+  italic     bool
+  underline  bool
+  strike     bool
+  smallCaps  bool
+  align      string
+  indent     int  // columns
+  margin     int
+  whiteSpace string
+}
+
+// cssElement is an open element with its style, and the escape
+// sequences written for it.
+type cssElement struct {
+  name    string
+  id      string
+  classes []string
+  style   cssStyle
+  open    string
+  close   string
+  block   bool
+}
+
+var (
+  cssCommentRe = regexp.MustCompile(`(?s)/\*.*?\*/`)
+  cssImportRe = regexp.MustCompile(`@import\s+(?:url\(\s*)?['"]?([^'")\s;]+)`)
+)
+
+// Elements levt lays out inline, which a display of block sets
+// apart as paragraphs.
+var phrasingElements = map[string]bool{
+  "span": true, "a": true, "em": true, "i": true, "b": true,
+  "strong": true, "small": true, "big": true, "abbr": true,
+  "cite": true, "dfn": true, "var": true, "mark": true, "s": true,
+  "u": true, "del": true, "ins": true, "font": true, "label": true,
+  "time": true, "code": true, "kbd": true, "samp": true, "tt": true,
+}
+
+// Styles the elements have without style sheets.
+var defaultStyles = map[string]func(*cssStyle){
+  "b": func(s *cssStyle) {s.bold = true},
+  "strong": func(s *cssStyle) {s.bold = true},
+  "th": func(s *cssStyle) {s.bold = true},
+  "dt": func(s *cssStyle) {s.bold = true},
+  "i": func(s *cssStyle) {s.italic = true},
+  "em": func(s *cssStyle) {s.italic = true},
+  "cite": func(s *cssStyle) {s.italic = true},
+  "var": func(s *cssStyle) {s.italic = true},
+  "dfn": func(s *cssStyle) {s.italic = true},
+  "u": func(s *cssStyle) {s.underline = true},
+  "ins": func(s *cssStyle) {s.underline = true},
+  "a": func(s *cssStyle) {s.underline = true},
+  "s": func(s *cssStyle) {s.strike = true},
+  "strike": func(s *cssStyle) {s.strike = true},
+  "del": func(s *cssStyle) {s.strike = true},
+  "pre": func(s *cssStyle) {s.whiteSpace = "pre"},
+}
+
+// loadCSS reads the style sheet at href, with those it imports.
+func (this *Document) loadCSS(href string) []cssRule {
+  if rules, ok := this.sheets[href]; ok {return rules}
+  if this.sheets == nil {this.sheets = map[string][]cssRule{}}
+  this.sheets[href] = nil
+
+  byt, err := epub.ReadContent(this.Files, href)
+  if err != nil {return nil}
+  rules := this.parseCSS(string(byt), href)
+  this.sheets[href] = rules
+  return rules
+}
+
+// parseCSS reads the rules of a style sheet, resolving imports
+// from base. Rules in @media blocks are read unless they are for
+// print only; other at-rules are left out.
+func (this *Document) parseCSS(src, base string) (rules []cssRule) {
+  src = cssCommentRe.ReplaceAllString(src, "")
+  for {
+    src = strings.TrimSpace(src)
+    if src == "" {break}
+
+    open := strings.IndexByte(src, '{')
+    if semi := strings.IndexByte(src, ';'); src[0] == '@' &&
+      semi >= 0 && (open < 0 || semi < open) {
+      if m := cssImportRe.FindStringSubmatch(src[:semi]); m != nil {
+        rules = append(rules, this.loadCSS(epub.ResolveHref(base, m[1]))...)
+      }
+      src = src[semi + 1:]
+      continue
+    }
+    if open < 0 {break}
+
+    close, depth := len(src), 0
+    for i := open; i < len(src); i++ {
+      if src[i] == '{' {depth++}
+      if src[i] == '}' {depth--}
+      if depth == 0 {
+        close = i
+        break
+      }
+    }
+    prelude, body := strings.TrimSpace(src[:open]), src[open + 1:close]
+    if close < len(src) {
+      src = src[close + 1:]
+    } else {
+      src = ""
+    }
+
+    switch {
+      case strings.HasPrefix(prelude, "@media"): {
+        media := strings.ToLower(prelude)
+        if strings.Contains(media, "print") && !strings.Contains(media, "screen") &&
+          !strings.Contains(media, "all") {
+          continue
+        }
+        rules = append(rules, this.parseCSS(body, base)...)
+      }
+      case strings.HasPrefix(prelude, "@"): {}
+      default: {
+        decls := parseDecls(body)
+        for _, s := range strings.Split(prelude, ",") {
+          if rule, ok := parseSelector(s); ok {
+            rule.decls = decls
+            rules = append(rules, rule)
+          }
+        }
+      }
+    }
+  }
+  return
+}
+
+// parseSelector reads a selector of elements, classes and ids,
+// taking children for descendants. Others are not supported.
+func parseSelector(s string) (rule cssRule, ok bool) {
+  s = strings.ReplaceAll(s, ">", " ")
+  if strings.ContainsAny(s, "+~[:|") {return rule, false}
+
+  for _, f := range strings.Fields(s) {
+    var c cssCompound
+    for f != "" {
+      end := strings.IndexAny(f[1:], ".#") + 1
+      if end == 0 {end = len(f)}
+      part := f[:end]
+      f = f[end:]
+      switch part[0] {
+        case '.': {
+          c.classes = append(c.classes, part[1:])
+          rule.specificity += 100
+        }
+        case '#': {
+          c.id = part[1:]
+          rule.specificity += 10000
+        }
+        default: {
+          c.name = strings.ToLower(part)
+          if c.name != "*" {rule.specificity++}
+        }
+      }
+    }
+    rule.parts = append(rule.parts, c)
+  }
+  return rule, len(rule.parts) > 0
+}
+
+func parseDecls(s string) (decls []cssDecl) {
+  for _, d := range strings.Split(s, ";") {
+    prop, value, ok := strings.Cut(d, ":")
+    if !ok {continue}
+    value = strings.TrimSpace(value)
+    important := strings.HasSuffix(value, "!important")
+    value = strings.TrimSpace(strings.TrimSuffix(value, "!important"))
+    decls = append(decls, cssDecl{
+      prop: strings.ToLower(strings.TrimSpace(prop)),
+      value: strings.ToLower(value),
+      important: important,
+    })
+  }
+  return
+}
+
+func (this cssCompound) match(e *cssElement) bool {
+  if this.name != "" && this.name != "*" && this.name != e.name {return false}
+  if this.id != "" && this.id != e.id {return false}
+  for _, c := range this.classes {
+    if !epub.HasToken(strings.Join(e.classes, " "), c) {return false}
+  }
+  return true
+}
+
+// match reports whether the rule applies to the last element of
+// the stack, its ancestors coming before it.
+func (this cssRule) match(stack []*cssElement) bool {
+  last := len(this.parts) - 1
+  if !this.parts[last].match(stack[len(stack) - 1]) {return false}
+  j := len(stack) - 2
+  for i := last - 1; i >= 0; i-- {
+    for j >= 0 && !this.parts[i].match(stack[j]) {j--}
+    if j < 0 {return false}
+    j--
+  }
+  return true
+}
+
+// cssCells turns a length into columns, taking a column for half
+// an em and a percentage of a 60 column line.
+func cssCells(v string) (int, bool) {
+  v = strings.TrimSpace(v)
+  units := []struct {
+    suffix string
+    cells  float64
+  }{
+    {"rem", 2}, {"em", 2}, {"ex", 1}, {"ch", 1}, {"px", 0.125},
+    {"pt", 1.0 / 6}, {"%", 0.6},
+  }
+  k := 0.0
+  for _, u := range units {
+    if strings.HasSuffix(v, u.suffix) {
+      v, k = strings.TrimSuffix(v, u.suffix), u.cells
+      break
+    }
+  }
+  n, err := strconv.ParseFloat(v, 64)
+  if err != nil || (k == 0 && n != 0) {return 0, false}
+  if n * k < 0 {return -int(-n * k + 0.5), true}
+  return int(n * k + 0.5), true
+}
+
+// apply sets a declaration on the style.
+func (this *cssStyle) apply(d cssDecl) {
+  v := d.value
+  switch d.prop {
+    case "display": {this.display = v}
+    case "font-weight": {
+      n, err := strconv.Atoi(v)
+      this.bold = v == "bold" || v == "bolder" || (err == nil && n >= 600)
+    }
+    case "font-style": {this.italic = v == "italic" || v == "oblique"}
+    case "font-variant", "font-variant-caps": {
+      this.smallCaps = strings.Contains(v, "small-caps")
+    }
+    case "font": {
+      for _, f := range strings.Fields(v) {
+        switch f {
+          case "bold", "bolder", "600", "700", "800", "900": {this.bold = true}
+          case "italic", "oblique": {this.italic = true}
+          case "small-caps": {this.smallCaps = true}
+        }
+      }
+    }
+    case "text-decoration", "text-decoration-line": {
+      this.underline = strings.Contains(v, "underline")
+      this.strike = strings.Contains(v, "line-through")
+    }
+    case "text-align": {
+      switch v {
+        case "center", "right": {this.align = v}
+        case "end": {this.align = "right"}
+        default: {this.align = ""}
+      }
+    }
+    case "text-indent": {
+      if n, ok := cssCells(v); ok {this.indent = n}
+    }
+    case "margin-left", "margin-inline-start": {
+      if n, ok := cssCells(v); ok {this.margin = n}
+    }
+    case "margin": {
+      f := strings.Fields(v)
+      left := map[int]int{1: 0, 2: 1, 3: 1, 4: 3}
+      if i, ok := left[len(f)]; ok {
+        if n, ok := cssCells(f[i]); ok {this.margin = n}
+      }
+    }
+    case "white-space": {this.whiteSpace = v}
+  }
+}
+
+// style is the style in effect at the current position.
+func (this *Document) style() cssStyle {
+  if n := len(this.elements); n > 0 {return this.elements[n - 1].style}
+  return cssStyle{}
+}
+
+// pushStyle enters an element, working out its style from the
+// style sheets and its style attribute. Font styles the sheets
+// give it are written as escape sequences.
+func (this *Document) pushStyle(token xml.StartElement) cssStyle {
+  parent := this.style()
+  e := &cssElement{
+    name: strings.ToLower(token.Name.Local),
+    id: epub.AttrValue(token, "id"),
+    classes: strings.Fields(epub.AttrValue(token, "class")),
+  }
+  this.elements = append(this.elements, e)
+
+  var matched []cssRule
+  for _, r := range this.rules {
+    if r.match(this.elements) {matched = append(matched, r)}
+  }
+  sort.SliceStable(matched, func(i, j int) bool {
+    return matched[i].specificity < matched[j].specificity
+  })
+  var decls []cssDecl
+  for _, r := range matched {decls = append(decls, r.decls...)}
+  decls = append(decls, parseDecls(epub.AttrValue(token, "style"))...)
+
+  s := parent
+  s.display, s.margin = "", 0
+  if f, ok := defaultStyles[e.name]; ok {f(&s)}
+  declared := map[string]bool{}
+  for _, important := range []bool{false, true} {
+    for _, d := range decls {
+      if d.important != important {continue}
+      s.apply(d)
+      declared[d.prop] = true
+    }
+  }
+  e.style = s
+
+  font := declared["font"]
+  escape := func(set, was, on bool, open, close string) {
+    if !set || on == was {return}
+    if !on {open, close = close, open}
+    e.open += open
+    e.close = close + e.close
+  }
+  escape(font || declared["font-weight"], parent.bold, s.bold, "\x1b[1m", "\x1b[22m")
+  escape(font || declared["font-style"], parent.italic, s.italic, "\x1b[3m", "\x1b[23m")
+  decoration := declared["text-decoration"] || declared["text-decoration-line"]
+  escape(decoration, parent.underline, s.underline, "\x1b[4m", "\x1b[24m")
+  escape(decoration, parent.strike, s.strike, "\x1b[9m", "\x1b[29m")
+  this.pending += e.open
+
+  if phrasingElements[e.name] && s.display != "" && s.display != "none" &&
+    !strings.HasPrefix(s.display, "inline") && s.display != "contents" {
+    e.block = true
+    this.newParagraph()
+  }
+  return s
+}
+
+// popStyle leaves the innermost element, undoing its escape
+// sequences unless nothing was written since them.
+func (this *Document) popStyle() cssStyle {
+  n := len(this.elements)
+  if n == 0 {return cssStyle{}}
+  e := this.elements[n - 1]
+  this.elements = this.elements[:n - 1]
+
+  if strings.HasSuffix(this.pending, e.open) {
+    this.pending = strings.TrimSuffix(this.pending, e.open)
+  } else if e.close != "" && this.content[this.Offset] != "" {
+    this.write(e.close)
+  }
+  if e.block {this.newParagraph()}
+  return e.style
+}
+
+// escapes returns the escape sequences starting a paragraph in
+// the style.
+func (this cssStyle) escapes() (s string) {
+  if this.bold {s += "\x1b[1m"}
+  if this.italic {s += "\x1b[3m"}
+  if this.underline {s += "\x1b[4m"}
+  if this.strike {s += "\x1b[9m"}
+  return
+}
+
+// cssMargin returns the left margin the style sheets give the
+// current position, leaving out the body, whose margins the
+// screen has.
+func (this *Document) cssMargin() (margin int) {
+  for _, e := range this.elements {
+    if e.name != "html" && e.name != "body" {margin += e.style.margin}
+  }
+  if margin < 0 {margin = 0}
+  if margin > 16 {margin = 16}
+  return
+}
+
+// readHead consumes the head of the document for its style sheets.
+func (this *Document) readHead(d *xml.Decoder) {
+  depth := 0
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    switch token := t.(type) {
+      case xml.StartElement: {
+        switch token.Name.Local {
+          case "link": {
+            href := epub.AttrValue(token, "href")
+            if epub.HasToken(strings.ToLower(epub.AttrValue(token, "rel")), "stylesheet") && href != "" {
+              this.rules = append(this.rules, this.loadCSS(epub.ResolveHref(this.Href, href))...)
+            }
+          }
+          case "style": {
+            this.rules = append(this.rules, this.parseCSS(epub.InnerText(d), this.Href)...)
+            continue
+          }
+        }
+        depth++
+      }
+      case xml.EndElement: {
+        if depth == 0 {return}
+        depth--
+      }
+    }
+  }
+}
+
+// writeText writes character data in the white space mode of the
+// style, breaking paragraphs at the new lines it keeps.
+func (this *Document) writeText(s string, style cssStyle) {
+  if style.smallCaps {s = strings.ToUpper(s)}
+  switch style.whiteSpace {
+    case "pre", "pre-wrap", "break-spaces", "pre-line": {}
+    default: {
+      this.write(s)
+      return
+    }
+  }
+  for i, line := range strings.Split(s, "\n") {
+    if i > 0 {this.Offset++}
+    if style.whiteSpace == "pre-line" {line = collapseSpaces(line)}
+    line = strings.ReplaceAll(line, "\t", "        ")
+    if line != "" {this.write(line)}
+  }
+}
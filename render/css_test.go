@@ -0,0 +1,61 @@
+package render
+
+import (
+  "testing"
+)
+
+func TestCSSSelectors(t *testing.T) {
+  body := &cssElement{name: "body"}
+  div := &cssElement{name: "div", id: "main", classes: []string{"chapter"}}
+  p := &cssElement{name: "p", classes: []string{"note", "first"}}
+  stack := []*cssElement{body, div, p}
+
+  for _, c := range []struct {
+    selector    string
+    specificity int
+    want        bool
+  }{
+    {"p", 1, true},
+    {"*", 0, true},
+    {".note", 100, true},
+    {"p.note.first", 201, true},
+    {"p.note.last", 201, false},
+    {".not", 100, false},
+    {"#main p", 10001, true},
+    {"div > p", 2, true},
+    {"body p", 2, true},
+    {"p div", 2, false},
+    {"div.chapter .note", 201, true},
+    {"section p", 2, false},
+  } {
+    rule, ok := parseSelector(c.selector)
+    if !ok {
+      t.Errorf("%q not parsed", c.selector)
+      continue
+    }
+    if rule.specificity != c.specificity {
+      t.Errorf("%q: specificity %d, want %d", c.selector, rule.specificity, c.specificity)
+    }
+    if got := rule.match(stack); got != c.want {
+      t.Errorf("%q: %v, want %v", c.selector, got, c.want)
+    }
+  }
+
+  for _, s := range []string{"a:hover", "h1 + p", "p ~ p", "[lang]", ""} {
+    if _, ok := parseSelector(s); ok {t.Errorf("%q parsed", s)}
+  }
+}
+
+func TestParseCSS(t *testing.T) {
+  var doc Document
+  rules := doc.parseCSS(`
+    p, .x {text-align: center}
+    @media print {p {display: none}}
+    @media screen {h1 {font-weight: bold !important}}
+    @font-face {font-family: x}
+  `, "")
+  if len(rules) != 3 {t.Fatalf("%d rules, want 3", len(rules))}
+  if d := rules[2].decls[0]; d.prop != "font-weight" || d.value != "bold" || !d.important {
+    t.Errorf("declaration read as %+v", d)
+  }
+}
@@ -0,0 +1,178 @@
+package render
+
+import (
+  "fmt"
+  "bytes"
+  "regexp"
+  "strings"
+  "encoding/xml"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+// Kinds of diagnostics, from the least to the most serious.
+const (
+  DiagUnknown = iota  // an element levt does not know
+  DiagRepaired        // broken markup was fixed or skipped
+  DiagTruncated       // the rest of the document was lost
+)
+
+var diagKinds = []string{"unknown", "repaired", "truncated"}
+
+// Diagnostic is a problem met while reading a document.
+type Diagnostic struct {
+  Kind    int
+  File    string
+  Line    int
+  Column  int
+  Element string  // the element the problem is in
+  Err     string
+}
+
+func (this Diagnostic) String() string {
+  s := fmt.Sprintf("%s:%d:%d: %s:", this.File, this.Line, this.Column, diagKinds[this.Kind])
+  if this.Element != "" {s += " <" + this.Element + ">"}
+  return s + " " + this.Err
+}
+
+// Elements of HTML, old and new, and those EPUB adds.
+var knownElements = map[string]bool{}
+
+func init() {
+  for _, name := range []string{
+    "a", "abbr", "acronym", "address", "area", "article", "aside",
+    "audio", "b", "base", "basefont", "bdi", "bdo", "big",
+    "blockquote", "body", "br", "button", "canvas", "caption",
+    "center", "cite", "code", "col", "colgroup", "data", "datalist",
+    "dd", "del", "details", "dfn", "dialog", "div", "dl", "dt", "em",
+    "embed", "fieldset", "figcaption", "figure", "font", "footer",
+    "form", "h1", "h2", "h3", "h4", "h5", "h6", "head", "header",
+    "hgroup", "hr", "html", "i", "iframe", "image", "img", "input",
+    "ins", "kbd", "label", "legend", "li", "link", "main", "map",
+    "mark", "math", "menu", "meta", "meter", "nav", "noscript",
+    "object", "ol", "optgroup", "option", "output", "p", "param",
+    "picture", "pre", "progress", "q", "rb", "rp", "rt", "rtc",
+    "ruby", "s", "samp", "script", "search", "section", "select",
+    "slot", "small", "source", "span", "strike", "strong", "style",
+    "sub", "summary", "sup", "svg", "table", "tbody", "td",
+    "template", "textarea", "tfoot", "th", "thead", "time", "title",
+    "tr", "track", "tt", "u", "ul", "var", "video", "wbr",
+    "switch", "case", "default",
+  } {
+    knownElements[name] = true
+  }
+}
+
+// End tags as they are written, or the slash of an empty element.
+var endTagRe = regexp.MustCompile(`(?:/|</(?:[\w.-]+:)?([\w.-]+)\s*)>$`)
+
+// report records a problem at the offset in the source.
+func (this *Document) report(kind int, at int64, element, err string) {
+  if at > int64(len(this.source)) {at = int64(len(this.source))}
+  if at < 0 {at = 0}
+  before := this.source[:at]
+  line := int64(bytes.LastIndexByte(before, '\n'))
+  column := at - line
+  for _, f := range this.fixes {
+    if f.at > line && f.at < at {column -= f.n}
+  }
+  this.Diagnostics = append(this.Diagnostics, Diagnostic{
+    Kind: kind,
+    File: this.Href,
+    Line: bytes.Count(before, []byte("\n")) + 1,
+    Column: int(column),
+    Element: element,
+    Err: err,
+  })
+}
+
+// offset is the position of the decoder in the source.
+func (this *Document) offset() int64 {
+  return this.base + this.decoder.InputOffset()
+}
+
+// current names the innermost open element.
+func (this *Document) current() string {
+  if n := len(this.elements); n > 0 {return this.elements[n - 1].name}
+  return ""
+}
+
+// checkStart reports elements that are not HTML, once each.
+func (this *Document) checkStart(token xml.StartElement) {
+  name := token.Name.Local
+  if knownElements[name] || this.unknown[name] {return}
+  if this.unknown == nil {this.unknown = map[string]bool{}}
+  this.unknown[name] = true
+  this.report(DiagUnknown, this.offset(), name, "unknown element")
+}
+
+// checkEnd reports end elements the decoder made up, for void
+// elements written without a slash or end tags that did not
+// match the element they closed. An end tag closing none of the
+// open elements is skipped, as the decoder would take it for the
+// end of them all; checkEnd then returns false.
+func (this *Document) checkEnd(token xml.EndElement) bool {
+  at := this.offset()
+  if at == this.repaired || at > int64(len(this.source)) {return true}
+  from := at - 64
+  if from < this.base {from = this.base}
+  if from < 0 {from = 0}
+  m := endTagRe.FindSubmatch(this.source[from:at])
+  if m != nil && (m[1] == nil || string(m[1]) == token.Name.Local) {return true}
+
+  if m != nil && !isVoid(token.Name.Local) && !this.isOpen(string(m[1])) {
+    this.report(DiagRepaired, at, this.current(), "unexpected end tag </" + string(m[1]) + ">")
+    this.resync(at - int64(len(m[0])), at)
+    return false
+  }
+
+  this.repaired = at
+  err := "no end tag"
+  if m != nil && !isVoid(token.Name.Local) {
+    err = "closed by </" + string(m[1]) + ">"
+  }
+  this.report(DiagRepaired, at, token.Name.Local, err)
+  return true
+}
+
+// isOpen reports whether an element of the name is open.
+func (this *Document) isOpen(name string) bool {
+  for _, e := range this.elements {
+    if strings.EqualFold(e.name, name) {return true}
+  }
+  return false
+}
+
+func isVoid(name string) bool {
+  for _, v := range epub.VoidElements {
+    if v == name {return true}
+  }
+  return false
+}
+
+// errText is the message of a decoding error, without the line
+// number of the decoder, which starts again on resyncing.
+func errText(err error) string {
+  if e, ok := err.(*xml.SyntaxError); ok {return e.Msg}
+  return err.Error()
+}
+
+// Severity returns the most serious kind of problem met so far,
+// or -1.
+func (this *Document) Severity() (kind int) {
+  kind = -1
+  for _, d := range this.Diagnostics {
+    if d.Kind > kind {kind = d.Kind}
+  }
+  return
+}
+
+
+// Diagnose reads the whole document for the problems met.
+func (this *Document) Diagnose() []Diagnostic {
+  this.Load()
+  for this.Line() == nil {}
+  diagnostics := this.Diagnostics
+  this.Close()
+  return diagnostics
+}
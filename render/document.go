@@ -0,0 +1,532 @@
+// Package render lays out the XHTML documents of a book as
+// wrapped, styled lines of terminal text.
+package render
+
+import (
+  "io"
+  "io/ioutil"
+  "bytes"
+  "regexp"
+  "strings"
+  "encoding/xml"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+var newLineRe *regexp.Regexp = regexp.MustCompile(
+  `[\s\t]*\n[\s\t]*`,
+)
+
+// LinkRe matches the markers of links and note references put
+// in the text, with their kind and target.
+var LinkRe *regexp.Regexp = regexp.MustCompile(
+  `##(link|note):([^;]+);`,
+)
+
+// Document renders a chapter as paragraphs of text, reading
+// as far into it as Line is called.
+type Document struct {
+  epub.Chapter
+  Files epub.Resources
+  Dir   string
+
+  Offset  int             // paragraph being read
+  Anchors map[string]int  // paragraphs of the ids
+  Diagnostics []Diagnostic
+
+  content map[int]string
+  blocks  map[int]*Block
+  langs   map[int]string
+  dirs    map[int]string
+  decoder *xml.Decoder
+  source  []byte
+  fixes   []fix
+  base    int64  // offset of the decoder in source
+  last    int64  // offset of the end of the last token read
+  primer  string  // start tags the decoder was given first
+  margins []*margin
+  lists   []*list
+  align   string
+  lang    string
+  dir     string
+  ruby    int
+  scripts []script
+  quotes  int
+  rules   []cssRule
+  sheets  map[string][]cssRule  // style sheets read, by href
+  pictures map[string]*Picture  // pictures read, by href and alt
+  elements []*cssElement
+  pending string
+  unknown map[string]bool
+  repaired int64
+}
+
+// Documents returns a Document for every chapter.
+func Documents(files epub.Resources, chapters []epub.Chapter) (docs []Document) {
+  for _, c := range chapters {
+    docs = append(docs, Document{Chapter: c, Files: files})
+  }
+  return
+}
+
+func (this *Document) Load() {
+  this.Diagnostics = nil
+  this.unknown = nil
+  this.repaired = -1
+  reader, err := this.Files.Open(this.Href)
+  this.source, this.fixes = nil, nil
+  if err == nil {
+    raw, _ := ioutil.ReadAll(reader)
+    reader.Close()
+    this.source, this.fixes = repairMarkup(raw)
+  } else {
+    this.report(DiagTruncated, 0, "", err.Error())
+  }
+  for _, f := range this.fixes {
+    this.report(DiagRepaired, f.at, f.element, f.err)
+  }
+
+  this.decoder = epub.NewDecoder(bytes.NewReader(this.source))
+  this.base = 0
+  this.last = 0
+  this.primer = ""
+  this.content = map[int]string{}
+  this.Anchors = map[string]int{}
+  this.blocks = map[int]*Block{}
+  this.langs = map[int]string{}
+  this.dirs = map[int]string{}
+  this.margins = nil
+  this.lists = nil
+  this.align = ""
+  this.lang = ""
+  this.dir = ""
+  this.ruby = rubyNone
+  this.scripts = nil
+  this.quotes = 0
+  this.rules = nil
+  this.elements = nil
+  this.pending = ""
+  this.Offset = 0
+}
+
+// Loaded reports whether the document is being read.
+func (this *Document) Loaded() bool {return this.decoder != nil}
+
+// Close stops reading the document, to be loaded again.
+func (this *Document) Close() {
+  this.decoder = nil
+  this.Offset = 0
+  this.source = nil
+}
+
+// Paragraph returns paragraph i as read, with the markers of
+// links and notes LinkRe matches and the runes setting off ruby,
+// and the block it is laid out by, if any.
+func (this *Document) Paragraph(i int) (string, *Block) {
+  return this.content[i], this.blocks[i]
+}
+
+// Lines lays out paragraph i for wrap, without markers, in the
+// direction it was written in. The hyphenator of its language
+// is used unless noHyphens.
+func (this *Document) Lines(i int, wrap Wrap, noHyphens bool) []string {
+  line := LinkRe.ReplaceAllString(this.content[i], "")
+  if wrap.Vertical {line = FullWidth(line)}
+  if wrap.Dir == "" {wrap.Dir = this.Dir}
+  if dir, ok := this.dirs[i]; ok {wrap.Dir = dir}
+  if !noHyphens {
+    lang := this.Lang
+    if l, ok := this.langs[i]; ok {lang = l}
+    wrap.Hyphens = GetHyphenator(lang)
+  }
+  return this.blocks[i].Layout(line, wrap)
+}
+
+// Text reads the whole document and lays it out for wrap.
+func (this *Document) Text(wrap Wrap) (lines []string) {
+  if !this.Loaded() {this.Load()}
+  for this.Line() == nil {}
+  for i := 0; i < this.Offset; i++ {
+    lines = append(lines, this.Lines(i, wrap, false)...)
+  }
+  return
+}
+
+func (this *Document) Line() error {
+  o := &this.Offset
+  c := this.content
+  for {
+    t, err := this.decoder.Token()
+    if t == nil {
+      if err == io.EOF {break}
+      at := this.offset()
+      if at >= int64(len(this.source)) {
+        // Only elements left open are repaired; a comment, tag
+        // or the like running to the end has lost the rest.
+        if complete(this.source[this.last:]) {
+          this.report(DiagRepaired, at, this.current(), "no end tag")
+        } else {
+          this.report(DiagTruncated, this.last, this.current(), errText(err))
+        }
+        break
+      }
+      if _, ok := err.(*xml.SyntaxError); ok {
+        this.report(DiagRepaired, at, this.current(), errText(err))
+        this.resync(at, at)
+        continue
+      }
+      this.report(DiagTruncated, at, this.current(), errText(err))
+      break
+    }
+    this.last = this.offset()
+    d := this.decoder
+    switch token := t.(type) {
+      case xml.CharData: {
+        style := this.style()
+        if strings.HasPrefix(style.whiteSpace, "pre") || style.whiteSpace == "break-spaces" {
+          this.writeText(string(token), style)
+          break
+        }
+        byt := bytes.Trim(token, "\n\t")
+        byt = newLineRe.ReplaceAll(byt, []byte(" "))
+
+        if c[*o] == "" {
+          byt = bytes.TrimLeft(byt, " \t")
+        }
+        if this.ruby == rubyBetween {
+          if len(bytes.TrimSpace(byt)) == 0 {break}
+          this.write(string(rubyStart))
+          this.ruby = rubyBase
+        }
+        if len(byt) != 0 {this.writeText(string(byt), style)}
+      }
+
+      case xml.StartElement: {
+        this.mark(token)
+        this.checkStart(token)
+        style := this.pushStyle(token)
+        if style.display == "none" {
+          d.Skip()
+          this.popStyle()
+          break
+        }
+        switch token.Name.Local {
+          case "p", "div": {
+            if strings.HasPrefix(style.display, "inline") {break}
+            *o++
+            this.mark(token)
+            this.lang = epub.AttrValue(token, "lang")
+            this.dir = textDirAttr(token)
+            return nil
+          }
+
+          case "a": {
+            kind := "link"
+            if isNoteref(token) {kind = "note"}
+            for _, attr := range token.Attr {
+              if attr.Name.Local == "href" {
+                this.write("##" + kind + ":" + attr.Value + ";")
+              }
+            }
+            this.write("\x1b[4m")
+          }
+
+          case "aside": {
+            if isNote(token) {
+              d.Skip()
+              this.popStyle()
+              break
+            }
+            this.pushMargin(asideRule, asideRule)
+            if this.newParagraph() {return nil}
+          }
+
+          case "table": {
+            this.putBlock(ReadTable(d).Render)
+            this.popStyle()
+            return nil
+          }
+
+          case "pre": {
+            this.putBlock(ReadCode(d, token).Render)
+            this.popStyle()
+            return nil
+          }
+          case "code", "kbd", "samp", "tt": {this.write("\x1b[36m")}
+
+          case "ul", "ol": {this.startList(token)}
+          case "li": {
+            this.startItem(token)
+            if this.newParagraph() {return nil}
+          }
+
+          case "blockquote": {
+            this.pushMargin(quoteRule, quoteRule)
+            if this.newParagraph() {return nil}
+          }
+          case "figure": {
+            this.pushMargin("  ", "  ")
+            if this.newParagraph() {return nil}
+          }
+          case "dd": {
+            this.pushMargin("    ", "    ")
+            if this.newParagraph() {return nil}
+          }
+          case "figcaption": {
+            this.align = "center"
+            brk := this.newParagraph()
+            this.write("\x1b[2m")
+            if brk {return nil}
+          }
+          case "dt": {
+            brk := this.newParagraph()
+            this.write("\x1b[1m")
+            if brk {return nil}
+          }
+          case "q": {
+            this.write(quoteMark(this.Lang, this.quotes, 0))
+            this.quotes++
+          }
+
+          case "img", "image": {
+            var link, src string
+            alt := "Image"
+            for _, attr := range token.Attr {
+              atn := attr.Name.Local
+              if atn == "alt" {alt = attr.Value}
+              if atn == "src" || atn == "href" {
+                src = attr.Value
+                link = "##link:" + attr.Value + ";"
+              }
+            }
+            if link == "" {break}
+            href := epub.ResolveHref(this.Href, src)
+            // Pictures get a paragraph of their own, keeping
+            // the link and the alt text for vertical lines.
+            if pic := this.picture(href, alt); pic != nil {
+              this.putPicture(pic, link + "\x1b[1;41m　" + alt + "　\x1b[22;40m")
+            } else if strings.HasSuffix(strings.ToLower(src), ".svg") {
+              this.putSVG(OpenSVG(this.Files, href), link, alt)
+            } else {
+              this.write(link + "\x1b[1;41m　" + alt + "　\x1b[22;40m")
+            }
+          }
+          case "svg": {
+            this.putSVG(ReadSVG(d, token, this.Files, this.Href), "", "Image")
+            this.popStyle()
+          }
+
+          case "i", "em": {this.write("\x1b[3m")}
+          case "b", "strong": {this.write("\x1b[1m")}
+          case "html", "body": {
+            if lang := epub.AttrValue(token, "lang"); lang != "" {
+              this.Lang = lang
+            }
+            if dir := textDirAttr(token); dir != "" {this.Dir = dir}
+          }
+          case "section": {}
+          case "head": {
+            this.readHead(d)
+            this.popStyle()
+          }
+          case "style": {
+            this.rules = append(this.rules, this.parseCSS(epub.InnerText(d), this.Href)...)
+            this.popStyle()
+          }
+
+          case "hr": {
+            *o++
+            this.mark(token)
+            this.write("* * *")
+            return nil
+          }
+
+          case "h1", "h2", "h3", "h4", "h5", "h6": {
+            *o++
+            this.mark(token)
+            this.write("\x1b[1m")
+            return nil
+          }
+
+          case "ruby": {
+            this.write(string(rubyStart))
+            this.ruby = rubyBase
+          }
+          case "rt": {
+            if this.ruby != rubyBase {
+              d.Skip()
+              this.popStyle()
+              break
+            }
+            this.write(string(rubySep))
+            this.ruby = rubyText
+          }
+          case "rp": {
+            d.Skip()
+            this.popStyle()
+          }
+
+          case "math": {
+            text := ReadMath(d, token)
+            this.popStyle()
+            if epub.AttrValue(token, "display") != "block" {
+              this.write(text)
+              break
+            }
+            this.newParagraph()
+            align := this.align
+            this.align = "center"
+            this.write(text)
+            this.align = align
+            this.newParagraph()
+            return nil
+          }
+
+          case "sup", "sub": {
+            this.scripts = append(this.scripts, script{
+              sup: token.Name.Local == "sup",
+              para: *o,
+              at: len(c[*o]),
+            })
+          }
+        }
+      }
+
+      case xml.EndElement: {
+        if !this.checkEnd(token) {continue}
+        style := this.popStyle()
+        switch token.Name.Local {
+          case "p", "div", "tr", "html": {
+            if strings.HasPrefix(style.display, "inline") {break}
+            this.lang = ""
+            this.dir = ""
+            if this.newParagraph() {return nil}
+          }
+
+          case "li", "blockquote", "figure", "dd", "aside": {
+            this.popMargin()
+            if this.newParagraph() {return nil}
+          }
+          case "figcaption", "dt": {
+            this.write("\x1b[22m")
+            this.align = ""
+            if this.newParagraph() {return nil}
+          }
+          case "q": {
+            this.quotes--
+            this.write(quoteMark(this.Lang, this.quotes, 1))
+          }
+
+          case "ul", "ol": {this.endList()}
+          case "sup", "sub": {this.endScript()}
+
+          case "rt": {
+            if this.ruby == rubyText {
+              this.write(string(rubyEnd))
+              this.ruby = rubyBetween
+            }
+          }
+          case "ruby": {
+            if this.ruby == rubyBase {
+              this.write(string(rubySep) + string(rubyEnd))
+            }
+            this.ruby = rubyNone
+          }
+
+          case "hr", "br": {
+            *o++
+            return nil
+          }
+
+          case "a": {this.write("\x1b[24m")}
+          case "code", "kbd", "samp", "tt": {this.write("\x1b[39m")}
+          case "i", "em": {this.write("\x1b[23m")}
+          case "b", "strong": {this.write("\x1b[22m")}
+
+          case "h1", "h2", "h3", "h4", "h5", "h6": {
+            this.write("\x1b[22m")
+            *o++
+            return nil
+          }
+        }
+      }
+    }
+  }
+
+  // The paragraph left open at the end is ended with the document.
+  if c[*o] != "" {*o++}
+  return io.EOF
+}
+
+// resync goes on from at with a new decoder, given first the
+// start tags of the elements the old one had open when it read
+// up to stop. They are found by reading its input again, as the
+// elements read whole by tables and the like are left open when
+// they end in an error. The style stack is brought in line.
+func (this *Document) resync(stop, at int64) {
+  from := this.base + int64(len(this.primer))
+  input := []byte(this.primer)
+  if stop > from {input = append(input, this.source[from:stop]...)}
+
+  var open []xml.StartElement
+  d := epub.NewDecoder(bytes.NewReader(input))
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    switch token := t.(type) {
+      case xml.StartElement: {open = append(open, token.Copy())}
+      case xml.EndElement: {
+        if len(open) > 0 {open = open[:len(open) - 1]}
+      }
+    }
+  }
+
+  same := 0
+  for same < len(open) && same < len(this.elements) &&
+    strings.EqualFold(open[same].Name.Local, this.elements[same].name) {
+    same++
+  }
+  for len(this.elements) > same {this.popStyle()}
+  for _, token := range open[same:] {this.pushStyle(token)}
+
+  this.primer = ""
+  for _, token := range open {this.primer += "<" + token.Name.Local + ">"}
+  this.base = at - int64(len(this.primer))
+  this.decoder = epub.NewDecoder(io.MultiReader(
+    strings.NewReader(this.primer),
+    bytes.NewReader(this.source[at:]),
+  ))
+  for range open {this.decoder.Token()}
+}
+
+// complete reports whether src reads as markup to its end, if
+// not as elements closed.
+func complete(src []byte) bool {
+  d := epub.NewDecoder(bytes.NewReader(src))
+  for {
+    if _, err := d.RawToken(); err != nil {return err == io.EOF}
+  }
+}
+
+// mark records the paragraph holding the element, so that
+// links to its id can be followed.
+func (this *Document) mark(token xml.StartElement) {
+  id := epub.AttrValue(token, "id")
+  if id == "" && token.Name.Local == "a" {
+    id = epub.AttrValue(token, "name")
+  }
+  if id != "" {this.Anchors[id] = this.Offset}
+}
+
+func attrLookup(token xml.StartElement, name string) (string, bool) {
+  for _, attr := range token.Attr {
+    if attr.Name.Local == name {return attr.Value, true}
+  }
+  return "", false
+}
+
+// textDirAttr reads the dir attribute, leaving "auto" to be
+// told from the text.
+func textDirAttr(token xml.StartElement) string {
+  dir := strings.ToLower(epub.AttrValue(token, "dir"))
+  if dir == "rtl" || dir == "ltr" {return dir}
+  return ""
+}
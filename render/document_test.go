@@ -0,0 +1,125 @@
+package render
+
+import (
+  "strings"
+  "testing"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+// readAll renders the whole of src, returning its paragraphs.
+func readAll(src string) (*Document, []string) {
+  doc := &Document{
+    Chapter: epub.Chapter{Item: epub.Item{Href: "a.xhtml"}},
+    Files: epub.Memory{"a.xhtml": []byte(src)},
+  }
+  doc.Load()
+  for doc.Line() == nil {}
+  var paras []string
+  for i := 0; i < doc.Offset; i++ {
+    if s := doc.content[i]; s != "" {paras = append(paras, stripEscapes(s))}
+  }
+  return doc, paras
+}
+
+func stripEscapes(s string) string {
+  for {
+    i := strings.Index(s, "\x1b[")
+    if i < 0 {return s}
+    j := strings.IndexByte(s[i:], 'm')
+    if j < 0 {return s}
+    s = s[:i] + s[i + j + 1:]
+  }
+}
+
+func TestRepairs(t *testing.T) {
+  tests := []struct {
+    src   string
+    paras []string
+    diags []string
+  }{
+    {
+      `<html><body><p><b>x</i>y</b> z</p><p>next</p></body></html>`,
+      []string{"xy z", "next"},
+      []string{"a.xhtml:1:24: repaired: <b> unexpected end tag </i>"},
+    },
+    {
+      `<html><body><p><i><b>x</i> y</p></body></html>`,
+      []string{"x y"},
+      []string{"a.xhtml:1:27: repaired: <b> closed by </i>"},
+    },
+    {
+      `<html><body><p>a < b, 1<2</p></body></html>`,
+      []string{"a < b, 1<2"},
+      []string{
+        "a.xhtml:1:18: repaired: < not escaped",
+        "a.xhtml:1:24: repaired: < not escaped",
+      },
+    },
+    {
+      `<html><body><p><a href=ch%201.xhtml class=x>link</a> after</p></body></html>`,
+      []string{"##link:ch%201.xhtml;link after"},
+      []string{
+        "a.xhtml:1:24: repaired: <a> attribute value without quotes",
+        "a.xhtml:1:43: repaired: <a> attribute value without quotes",
+      },
+    },
+    {
+      `<html><body><table><tr><td>a</td></tr></table><p>after</p></body></html>`,
+      []string{"after"},
+      nil,
+    },
+  }
+  for _, test := range tests {
+    doc, paras := readAll(test.src)
+    if strings.Join(paras, "|") != strings.Join(test.paras, "|") {
+      t.Errorf("%s:\n got %q\nwant %q", test.src, paras, test.paras)
+    }
+    var diags []string
+    for _, d := range doc.Diagnostics {diags = append(diags, d.String())}
+    if strings.Join(diags, "\n") != strings.Join(test.diags, "\n") {
+      t.Errorf("%s:\n got %q\nwant %q", test.src, diags, test.diags)
+    }
+  }
+}
+
+func TestTruncated(t *testing.T) {
+  tests := []struct {
+    src   string
+    kind  int
+    last  string  // the last paragraph shown
+  }{
+    {`<html><body><p>x</p><!-- never closed <p>lost</p></body></html>`, DiagTruncated, "x"},
+    {`<html><body><p>x</p><![CDATA[never closed <p>lost</p></body></html>`, DiagTruncated, "x"},
+    {`<html><body><table><tr><td>x<!-- </td></tr></table></body></html>`, DiagTruncated, ""},
+    {`<html><body><p>x</p><p>y`, DiagRepaired, "y"},
+    {`<html><body><p>one<p>two`, DiagRepaired, "two"},
+    {`<html><body><p>one</p>tail text`, DiagRepaired, "tail text"},
+    {`<html><body><table><tr><td>x</td></tr></table>` + "\n", DiagRepaired, ""},
+  }
+  for _, test := range tests {
+    doc, paras := readAll(test.src)
+    if kind := doc.Severity(); kind != test.kind {
+      t.Errorf("%s: %s, want %s\n%v", test.src, diagKinds[kind], diagKinds[test.kind], doc.Diagnostics)
+    }
+    if test.last != "" && (len(paras) == 0 || paras[len(paras) - 1] != test.last) {
+      t.Errorf("%s: paragraphs %q, want the last %q", test.src, paras, test.last)
+    }
+  }
+}
+
+func TestText(t *testing.T) {
+  doc := &Document{
+    Chapter: epub.Chapter{Item: epub.Item{Href: "a.xhtml"}},
+    Files: epub.Memory{"a.xhtml": []byte(`<html><body>
+      <p>See <a href="b.xhtml#x">the note</a><a epub:type="noteref" href="#n1">1</a>.</p>
+      <p><ruby>漢<rt>かん</rt></ruby></p>
+      <table><tr><th>A</th><th>B</th></tr><tr><td>1</td><td>2</td></tr></table>
+    </body></html>`)},
+  }
+  text := stripEscapes(strings.Join(doc.Text(Wrap{Width: 40, Ruby: RubyInline}), "\n"))
+  for _, want := range []string{"See the note1.", "漢（かん）", "│ A │ B │", "│ 1 │ 2 │"} {
+    if !strings.Contains(text, want) {t.Errorf("no %q in\n%s", want, text)}
+  }
+  if strings.ContainsAny(text, "#￹￺￻") {t.Errorf("markers left in\n%s", text)}
+}
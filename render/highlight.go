@@ -0,0 +1,291 @@
+package render
+
+import (
+  "regexp"
+  "strings"
+  "encoding/json"
+)
+
+const (
+  colorKeyword  = "\x1b[35m"
+  colorBuiltin  = "\x1b[36m"
+  colorString   = "\x1b[32m"
+  colorNumber   = "\x1b[33m"
+  colorComment  = "\x1b[34m"
+  colorReset    = "\x1b[39m"
+)
+
+type syntax struct {
+  keywords  map[string]bool
+  builtins  map[string]bool
+  comments  []string     // line comments
+  blocks    [][2]string  // block comments
+  quotes    string       // single line string delimiters
+  long      []string     // multi line string delimiters
+  variables bool         // $NAME and ${NAME} as in shell
+  keys      bool         // "key": and key: highlighted as names
+}
+
+func words(s string) map[string]bool {
+  m := map[string]bool{}
+  for _, v := range strings.Fields(s) {m[v] = true}
+  return m
+}
+
+var syntaxes = map[string]*syntax{
+  "go": {
+    keywords: words(`break case chan const continue default defer else
+      fallthrough for func go goto if import interface map package range
+      return select struct switch type var`),
+    builtins: words(`bool byte complex64 complex128 error float32 float64
+      int int8 int16 int32 int64 rune string uint uint8 uint16 uint32
+      uint64 uintptr any true false nil iota append cap close copy delete
+      len make new panic print println recover`),
+    comments: []string{"//"},
+    blocks: [][2]string{{"/*", "*/"}},
+    quotes: `"'`,
+    long: []string{"`"},
+  },
+  "python": {
+    keywords: words(`and as assert async await break class continue def
+      del elif else except finally for from global if import in is lambda
+      nonlocal not or pass raise return try while with yield`),
+    builtins: words(`True False None self print len range int str float
+      list dict set tuple bool open isinstance super object type`),
+    comments: []string{"#"},
+    quotes: `"'`,
+    long: []string{`"""`, `'''`},
+  },
+  "javascript": {
+    keywords: words(`async await break case catch class const continue
+      debugger default delete do else export extends finally for from
+      function if import in instanceof let new of return static super
+      switch this throw try typeof var void while with yield`),
+    builtins: words(`true false null undefined NaN Infinity console
+      document window Object Array String Number Boolean Promise JSON Math`),
+    comments: []string{"//"},
+    blocks: [][2]string{{"/*", "*/"}},
+    quotes: `"'`,
+    long: []string{"`"},
+  },
+  "c": {
+    keywords: words(`auto break case const continue default do else enum
+      extern for goto if inline register restrict return sizeof static
+      struct switch typedef union volatile while class public private
+      protected namespace template typename new delete try catch throw
+      using virtual #include #define #ifdef #ifndef #endif #if #else`),
+    builtins: words(`void char short int long float double signed unsigned
+      bool size_t NULL true false nullptr std printf malloc free`),
+    comments: []string{"//"},
+    blocks: [][2]string{{"/*", "*/"}},
+    quotes: `"'`,
+  },
+  "shell": {
+    keywords: words(`if then else elif fi for while until do done case esac
+      in function return exit export local readonly`),
+    builtins: words(`echo cd ls cat grep sed awk cp mv rm mkdir sudo source
+      printf read test set unset git make go npm pip python curl`),
+    comments: []string{"#"},
+    quotes: `"'`,
+    variables: true,
+  },
+  "json": {
+    builtins: words(`true false null`),
+    quotes: `"`,
+    keys: true,
+  },
+  "yaml": {
+    builtins: words(`true false null yes no on off ~`),
+    comments: []string{"#"},
+    quotes: `"'`,
+    keys: true,
+  },
+}
+
+var langAliases = map[string]string{
+  "golang": "go",
+  "py": "python", "python3": "python",
+  "js": "javascript", "jsx": "javascript", "ts": "javascript",
+  "typescript": "javascript", "node": "javascript",
+  "h": "c", "cpp": "c", "c++": "c", "cc": "c", "java": "c",
+  "cs": "c", "csharp": "c",
+  "sh": "shell", "bash": "shell", "zsh": "shell", "console": "shell",
+  "shell-session": "shell",
+  "yml": "yaml",
+}
+
+var langHints = map[string][]*regexp.Regexp{
+  "go": regexps(`(?m)^package \w+$`, `\bfunc (\(\w+ \*?\w+\) )?\w*\(`,
+    `:=`, `\bfmt\.`, `(?m)^import \($`),
+  "python": regexps(`(?m)^\s*def \w+\(.*\):\s*$`, `(?m)^\s*import \w+$`,
+    `(?m)^\s*from [\w.]+ import`, `\bself\.`, `(?m):\s*$`),
+  "javascript": regexps(`\bfunction\b`, `\b(const|let) \w+ =`, `=>`,
+    `\bconsole\.log\(`, `\brequire\(`),
+  "c": regexps(`(?m)^#include\b`, `\bint main\(`, `\bprintf\(`,
+    `(?m);\s*$`, `\b(void|char|int)\s+\*?\w+\(`),
+  "shell": regexps(`(?m)^#!.*sh\b`, `(?m)^\$ `, `\becho\b`, `\bsudo\b`,
+    `(?m)^\s*(cd|ls|export|apt|git|npm|pip|make|curl) `),
+  "yaml": regexps(`(?m)^\s*[\w.-]+:(\s|$)`, `(?m)^\s*- \w`, `(?m)^---$`),
+}
+
+func regexps(s ...string) (res []*regexp.Regexp) {
+  for _, v := range s {res = append(res, regexp.MustCompile(v))}
+  return
+}
+
+// GuessLang picks the language whose hints match src the most,
+// or returns "" when none is convincing.
+func GuessLang(src string) string {
+  trim := strings.TrimSpace(src)
+  if strings.HasPrefix(trim, "{") || strings.HasPrefix(trim, "[") {
+    if json.Valid([]byte(trim)) {return "json"}
+  }
+
+  best, score := "", 1
+  for lang, hints := range langHints {
+    n := 0
+    for _, re := range hints {
+      if re.MatchString(src) {n++}
+    }
+    if n > score || n == score && best != "" && lang < best {
+      best, score = lang, n
+    }
+  }
+  return best
+}
+
+// Highlight colours src as lang, returning its lines with every
+// span closed on the line it started.
+func Highlight(lang, src string) []string {
+  if alias, ok := langAliases[lang]; ok {lang = alias}
+  if lang == "" {lang = GuessLang(src)}
+  syn, ok := syntaxes[lang]
+  if !ok {return strings.Split(src, "\n")}
+
+  var lines []string
+  line := ""
+  emit := func(text, color string) {
+    for i, v := range strings.Split(text, "\n") {
+      if i > 0 {
+        lines = append(lines, line)
+        line = ""
+      }
+      if v == "" {continue}
+      if color == "" {
+        line += v
+      } else {
+        line += color + v + colorReset
+      }
+    }
+  }
+
+  for i := 0; i < len(src); {
+    rest := src[i:]
+    n, color := syn.token(rest, line)
+    emit(rest[:n], color)
+    i += n
+  }
+  return append(lines, line)
+}
+
+// token returns the length and colour of the token at the start of
+// s; line holds the current line up to s.
+func (this *syntax) token(s string, line string) (int, string) {
+  for _, b := range this.blocks {
+    if strings.HasPrefix(s, b[0]) {
+      end := strings.Index(s[len(b[0]):], b[1])
+      if end < 0 {return len(s), colorComment}
+      return len(b[0]) + end + len(b[1]), colorComment
+    }
+  }
+  for _, c := range this.comments {
+    if strings.HasPrefix(s, c) && (c != "#" || commentStart(line)) {
+      end := strings.Index(s, "\n")
+      if end < 0 {end = len(s)}
+      return end, colorComment
+    }
+  }
+  for _, q := range this.long {
+    if strings.HasPrefix(s, q) {
+      end := strings.Index(s[len(q):], q)
+      if end < 0 {return len(s), colorString}
+      return len(q) + end + len(q), colorString
+    }
+  }
+
+  c := s[0]
+  if strings.IndexByte(this.quotes, c) >= 0 {
+    n := 1
+    for n < len(s) && s[n] != c && s[n] != '\n' {
+      if s[n] == '\\' {n++}
+      n++
+    }
+    if n < len(s) && s[n] == c {n++}
+    if n > len(s) {n = len(s)}
+    if this.keys && keyFollows(s[n:]) {return n, colorBuiltin}
+    return n, colorString
+  }
+
+  if this.variables && c == '$' && len(s) > 1 {
+    if s[1] == '{' {
+      if end := strings.IndexByte(s, '}'); end > 0 {
+        return end + 1, colorBuiltin
+      }
+    }
+    n := 1 + wordLen(s[1:])
+    if n > 1 {return n, colorBuiltin}
+  }
+
+  if isDigit(c) && !isWord(lastByte(line)) {
+    n := 1
+    for n < len(s) && (isWord(s[n]) || s[n] == '.') {n++}
+    return n, colorNumber
+  }
+
+  if n := wordLen(s); n > 0 {
+    if c == '#' || isWord(c) {
+      w := s[:n]
+      if this.keys && keyFollows(s[n:]) &&
+        strings.TrimLeft(line, " -") == "" {return n, colorBuiltin}
+      if this.keywords[w] {return n, colorKeyword}
+      if this.builtins[w] {return n, colorBuiltin}
+      return n, ""
+    }
+  }
+  return 1, ""
+}
+
+// wordLen is the length of the identifier at the start of s,
+// allowing a leading # for C preprocessor directives.
+func wordLen(s string) (n int) {
+  if len(s) > 0 && s[0] == '#' {n++}
+  for n < len(s) && isWord(s[n]) {n++}
+  if n == 1 && s[0] == '#' {return 0}
+  return
+}
+
+func keyFollows(s string) bool {
+  s = strings.TrimLeft(s, " \t")
+  return strings.HasPrefix(s, ":") &&
+    (len(s) == 1 || s[1] == ' ' || s[1] == '\n' || s[1] == '\t')
+}
+
+// commentStart reports whether a # at the end of line starts a
+// comment rather than being part of a word.
+func commentStart(line string) bool {
+  c := lastByte(line)
+  return c == 0 || c == ' ' || c == '\t'
+}
+
+func lastByte(s string) byte {
+  s = sgrRe.ReplaceAllString(s, "")
+  if s == "" {return 0}
+  return s[len(s) - 1]
+}
+
+func isDigit(c byte) bool {return c >= '0' && c <= '9'}
+
+func isWord(c byte) bool {
+  return c == '_' || isDigit(c) || c >= 'a' && c <= 'z' ||
+    c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,197 @@
+package render
+
+import (
+  "os"
+  "sync"
+  "bufio"
+  "strings"
+  "unicode"
+  "path/filepath"
+)
+
+// Hyphenator finds hyphenation points with Liang's algorithm
+// from TeX style patterns such as "hy3ph" or ".ach4".
+type Hyphenator struct {
+  Patterns    map[string][]int
+  Exceptions  map[string][]int
+  LeftMin     int
+  RightMin    int
+
+  maxLen  int
+}
+
+// Directories searched for pattern files. Both the hyph-utf8
+// .pat.txt files of TeX and the hyph_*.dic files of hunspell are
+// understood.
+var HyphenDirs = []string{
+  "/usr/share/texlive/texmf-dist/tex/generic/hyph-utf8/patterns/txt",
+  "/usr/share/texmf-dist/tex/generic/hyph-utf8/patterns/txt",
+  "/usr/local/texlive/texmf-dist/tex/generic/hyph-utf8/patterns/txt",
+  "/usr/share/hyph-utf8",
+  "/usr/share/hyphen",
+  "/usr/share/myspell/dicts",
+  "/usr/local/share/hyphen",
+}
+
+// Hyphenators loaded, by language.
+var (
+  hyphenators = map[string]*Hyphenator{}
+  hyphenMutex sync.Mutex
+)
+
+// Pattern sets to use for a language that has none of its own.
+var hyphenAliases = map[string]string{
+  "en": "en-us",
+  "de": "de-1996",
+  "el": "el-monoton",
+  "mn": "mn-cyrl",
+  "sr": "sh-latn",
+  "la": "la-x-classic",
+}
+
+// GetHyphenator loads the patterns for a language tag, trying
+// "pt-br" before "pt". It returns nil when none are installed.
+func GetHyphenator(lang string) *Hyphenator {
+  lang = strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+  if lang == "" {return nil}
+  hyphenMutex.Lock()
+  defer hyphenMutex.Unlock()
+  if h, ok := hyphenators[lang]; ok {return h}
+
+  var h *Hyphenator
+  for tag := lang; tag != "" && h == nil; {
+    h = loadHyphenator(tag)
+    i := strings.LastIndex(tag, "-")
+    if i < 0 {break}
+    tag = tag[:i]
+  }
+  base, _, _ := strings.Cut(lang, "-")
+  if alias, ok := hyphenAliases[base]; ok && h == nil {
+    h = loadHyphenator(alias)
+  }
+
+  hyphenators[lang] = h
+  return h
+}
+
+func loadHyphenator(tag string) *Hyphenator {
+  parts := strings.Split(tag, "-")
+  if len(parts) > 1 {parts[1] = strings.ToUpper(parts[1])}
+  dic := "hyph_" + strings.Join(parts, "_") + ".dic"
+
+  for _, dir := range HyphenDirs {
+    pat := filepath.Join(dir, "hyph-" + tag + ".pat.txt")
+    if h := readPatterns(pat, false); h != nil {
+      h.readExceptions(filepath.Join(dir, "hyph-" + tag + ".hyp.txt"))
+      return h
+    }
+    if h := readPatterns(filepath.Join(dir, dic), true); h != nil {
+      return h
+    }
+  }
+  return nil
+}
+
+func readPatterns(path string, dic bool) *Hyphenator {
+  file, err := os.Open(path)
+  if err != nil {return nil}
+  defer file.Close()
+
+  h := &Hyphenator{
+    Patterns: map[string][]int{},
+    Exceptions: map[string][]int{},
+    LeftMin: 2,
+    RightMin: 3,
+  }
+  scanner := bufio.NewScanner(file)
+  first := true
+  for scanner.Scan() {
+    line := scanner.Text()
+    if i := strings.IndexAny(line, "%#"); i >= 0 {line = line[:i]}
+
+    // hunspell files start with the charset and may set the
+    // minimal word parts before the patterns.
+    if dic {
+      if first {
+        first = false
+        continue
+      }
+      fields := strings.Fields(line)
+      if len(fields) == 2 && strings.HasSuffix(fields[0], "HYPHENMIN") {
+        n := 0
+        for _, c := range fields[1] {n = n * 10 + int(c - '0')}
+        if strings.HasPrefix(fields[0], "LEFT") {h.LeftMin = n}
+        if strings.HasPrefix(fields[0], "RIGHT") {h.RightMin = n}
+        continue
+      }
+      if strings.ContainsAny(line, "/=") || strings.HasPrefix(line, "NEXTLEVEL") {
+        continue
+      }
+    }
+
+    for _, p := range strings.Fields(line) {h.addPattern(p)}
+  }
+  if len(h.Patterns) == 0 {return nil}
+  return h
+}
+
+func (this *Hyphenator) addPattern(p string) {
+  var letters []rune
+  levels := []int{0}
+  for _, r := range p {
+    if r >= '0' && r <= '9' {
+      levels[len(levels) - 1] = int(r - '0')
+      continue
+    }
+    letters = append(letters, unicode.ToLower(r))
+    levels = append(levels, 0)
+  }
+  this.Patterns[string(letters)] = levels
+  if len(letters) > this.maxLen {this.maxLen = len(letters)}
+}
+
+// readExceptions reads words hyphenated by hand, as "ta-ble".
+func (this *Hyphenator) readExceptions(path string) {
+  byt, err := os.ReadFile(path)
+  if err != nil {return}
+  for _, word := range strings.Fields(string(byt)) {
+    var points []int
+    n := 0
+    for _, r := range word {
+      if r == '-' {
+        points = append(points, n)
+        continue
+      }
+      n++
+    }
+    this.Exceptions[strings.ReplaceAll(strings.ToLower(word), "-", "")] = points
+  }
+}
+
+// Points returns the positions, in runes, before which word may
+// be hyphenated.
+func (this *Hyphenator) Points(word string) (points []int) {
+  lower := strings.ToLower(word)
+  if p, ok := this.Exceptions[lower]; ok {return p}
+
+  runes := []rune("." + lower + ".")
+  n := len(runes) - 2
+  if n < this.LeftMin + this.RightMin {return nil}
+
+  levels := make([]int, len(runes) + 1)
+  for i := range runes {
+    for l := 1; l <= this.maxLen && i + l <= len(runes); l++ {
+      p, ok := this.Patterns[string(runes[i:i + l])]
+      if !ok {continue}
+      for j, v := range p {
+        if v > levels[i + j] {levels[i + j] = v}
+      }
+    }
+  }
+
+  // levels[k] sits before runes[k]; runes[1] is the first letter.
+  for k := 1 + this.LeftMin; k <= n + 1 - this.RightMin; k++ {
+    if levels[k] % 2 == 1 {points = append(points, k - 1)}
+  }
+  return
+}
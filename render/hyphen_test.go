@@ -0,0 +1,58 @@
+package render
+
+import (
+  "os"
+  "testing"
+  "reflect"
+  "path/filepath"
+)
+
+// testHyphenator has the patterns Liang's thesis hyphenates
+// "hyphenation" with.
+func testHyphenator() *Hyphenator {
+  h := &Hyphenator{
+    Patterns: map[string][]int{},
+    Exceptions: map[string][]int{},
+    LeftMin: 2,
+    RightMin: 3,
+  }
+  for _, p := range []string{"hy3ph", "he2n", "hena4", "hen5at", "1na", "n2at", "1tio", "2io", "o2n"} {
+    h.addPattern(p)
+  }
+  return h
+}
+
+func TestHyphenPoints(t *testing.T) {
+  h := testHyphenator()
+  for word, want := range map[string][]int{
+    "hyphenation": {2, 6},
+    "Hyphenation": {2, 6},
+    "hyph": nil,
+  } {
+    if got := h.Points(word); !reflect.DeepEqual(got, want) {
+      t.Errorf("%s: %v, want %v", word, got, want)
+    }
+  }
+}
+
+func TestReadPatterns(t *testing.T) {
+  dir := t.TempDir()
+  os.WriteFile(filepath.Join(dir, "hyph-xx.pat.txt"), []byte("% comment\nhy3ph he2n hena4\nhen5at 1na n2at\n1tio 2io o2n\n"), 0666)
+  os.WriteFile(filepath.Join(dir, "hyph-xx.hyp.txt"), []byte("ta-ble\n"), 0666)
+  os.WriteFile(filepath.Join(dir, "hyph_yy.dic"), []byte("UTF-8\nLEFTHYPHENMIN 1\nhy3ph\n1na\n"), 0666)
+
+  h := readPatterns(filepath.Join(dir, "hyph-xx.pat.txt"), false)
+  if h == nil {t.Fatal("patterns not read")}
+  h.readExceptions(filepath.Join(dir, "hyph-xx.hyp.txt"))
+  if got := h.Points("hyphenation"); !reflect.DeepEqual(got, []int{2, 6}) {t.Errorf("hyphenation: %v", got)}
+  if got := h.Points("Table"); !reflect.DeepEqual(got, []int{2}) {t.Errorf("table: %v", got)}
+
+  d := readPatterns(filepath.Join(dir, "hyph_yy.dic"), true)
+  if d == nil || d.LeftMin != 1 || len(d.Patterns) != 2 {t.Fatalf("dic not read: %+v", d)}
+}
+
+func TestWrapHyphens(t *testing.T) {
+  got := Wrap{Width: 10, Hyphens: testHyphenator()}.Lines("the hyphenation of words")
+  want := []string{"the hy-", "phenation", "of words"}
+  if !reflect.DeepEqual(got, want) {t.Errorf("%q, want %q", got, want)}
+}
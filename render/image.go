@@ -0,0 +1,486 @@
+package render
+
+import (
+  "os"
+  "fmt"
+  "sync"
+  "bytes"
+  "image"
+  "strings"
+  "sync/atomic"
+  "image/png"
+  "image/color"
+  "encoding/base64"
+  _ "image/gif"
+  _ "image/jpeg"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+// Ways of drawing pictures: half blocks in 256 or 24 bit colour,
+// or one of the terminal graphics protocols.
+const (
+  GraphicsBlocks = iota
+  GraphicsTrueColor
+  GraphicsKitty
+  GraphicsITerm
+  GraphicsSixel
+)
+
+var graphicsModes = map[string]int{
+  "blocks": GraphicsBlocks,
+  "256": GraphicsBlocks,
+  "truecolor": GraphicsTrueColor,
+  "kitty": GraphicsKitty,
+  "iterm": GraphicsITerm,
+  "sixel": GraphicsSixel,
+}
+
+// Size in pixels taken for a character cell, which the terminal
+// does not tell us.
+const (
+  cellPxWidth  = 10
+  cellPxHeight = 20
+)
+
+// Screen is a terminal pictures are drawn on, with the way it
+// draws them. It keeps the pictures sent to kitty, which holds on
+// to them for as long as it runs.
+type Screen struct {
+  Graphics int
+
+  mu   sync.Mutex
+  sent map[string]int  // ids of the pictures, by href and size
+}
+
+// NewScreen returns a Screen drawing pictures as told.
+func NewScreen(graphics int) *Screen {
+  return &Screen{Graphics: graphics, sent: map[string]int{}}
+}
+
+// DetectGraphics picks the way of drawing pictures from what the
+// terminal advertises in the environment, or from LEVT_GRAPHICS.
+func DetectGraphics() int {
+  mode := strings.ToLower(os.Getenv("LEVT_GRAPHICS"))
+  if m, ok := graphicsModes[mode]; ok {return m}
+
+  term, program := os.Getenv("TERM"), os.Getenv("TERM_PROGRAM")
+  switch {
+    case term == "xterm-kitty", os.Getenv("KITTY_WINDOW_ID") != "",
+      program == "ghostty": {
+      return GraphicsKitty
+    }
+    case program == "iTerm.app", program == "WezTerm",
+      os.Getenv("LC_TERMINAL") == "iTerm2": {
+      return GraphicsITerm
+    }
+    case strings.Contains(term, "sixel"), term == "foot",
+      strings.HasPrefix(term, "mlterm"): {
+      return GraphicsSixel
+    }
+  }
+  switch os.Getenv("COLORTERM") {
+    case "truecolor", "24bit": {return GraphicsTrueColor}
+  }
+  return GraphicsBlocks
+}
+
+// Picture is an image set in the page flow as a block of its own.
+type Picture struct {
+  Href   string
+  Alt    string
+
+  image  image.Image  // decoded when first drawn
+  files  epub.Resources
+  width  int  // size in pixels
+  height int
+  id     int
+  cols   int  // size of the last rendering, in cells
+  rows   int
+  mode   int  // graphics of the last rendering
+  lines  []string
+  data   string
+  size   [3]int  // size and graphics data was encoded for
+}
+
+var pictureIDs int64
+
+// Pictures larger than this many pixels are not read, as decoding
+// them would take more memory than a page of text is worth.
+const maxPicturePixels = 1 << 25
+
+// newPicture returns the picture of img, with an id of its own.
+func newPicture(href, alt string, img image.Image) *Picture {
+  id := int(atomic.AddInt64(&pictureIDs, 1))
+  pic := &Picture{Href: href, Alt: alt, image: img, id: id}
+  if img != nil {
+    b := img.Bounds()
+    pic.width, pic.height = b.Dx(), b.Dy()
+  }
+  return pic
+}
+
+// ReadPicture reads the size of the PNG, JPEG or GIF at href,
+// returning nil when it cannot or the picture is too large. The
+// picture itself is decoded when first drawn.
+func ReadPicture(files epub.Resources, href, alt string) *Picture {
+  reader, err := files.Open(href)
+  if err != nil {return nil}
+  defer reader.Close()
+
+  config, _, err := image.DecodeConfig(reader)
+  if err != nil {return nil}
+  w, h := config.Width, config.Height
+  if w < 1 || h < 1 || int64(w) * int64(h) > maxPicturePixels {return nil}
+
+  pic := newPicture(href, alt, nil)
+  pic.files, pic.width, pic.height = files, w, h
+  return pic
+}
+
+// Image returns the picture decoded, reading it the first time.
+// A picture that turns out not to decode is left transparent.
+func (this *Picture) Image() image.Image {
+  if this.image != nil {return this.image}
+  if reader, err := this.files.Open(this.Href); err == nil {
+    this.image, _, _ = image.Decode(reader)
+    reader.Close()
+  }
+  if this.image == nil {this.image = image.NewNRGBA(image.Rect(0, 0, 1, 1))}
+  return this.image
+}
+
+// picture returns the picture at href, read once for the document
+// rather than every time it is loaded again.
+func (this *Document) picture(href, alt string) *Picture {
+  key := href + "\x00" + alt
+  if pic, ok := this.pictures[key]; ok {return pic}
+  if this.pictures == nil {this.pictures = map[string]*Picture{}}
+  pic := ReadPicture(this.Files, href, alt)
+  this.pictures[key] = pic
+  return pic
+}
+
+// fit returns the cells the picture takes at most width columns
+// and height rows, without enlarging it past its pixel size.
+func (this *Picture) fit(width, height int) (cols, rows int) {
+  w, h := this.width, this.height
+
+  cols = (w + cellPxWidth - 1) / cellPxWidth
+  if cols > width {cols = width}
+  rows = (cols * cellPxWidth * h / w + cellPxHeight - 1) / cellPxHeight
+  if height > 0 && rows > height {
+    rows = height
+    cols = rows * cellPxHeight * w / (h * cellPxWidth)
+  }
+  if cols < 1 {cols = 1}
+  if rows < 1 {rows = 1}
+  return
+}
+
+// Render draws the picture in half blocks, or leaves room for
+// graphics of the terminal to draw it.
+func (this *Picture) Render(width, height, graphics int) []string {
+  cols, rows := this.fit(width, height)
+  if this.lines != nil && cols == this.cols && rows == this.rows && graphics == this.mode {
+    return append([]string{}, this.lines...)
+  }
+  this.cols, this.rows, this.mode = cols, rows, graphics
+  if graphics >= GraphicsKitty {
+    this.lines = this.blank()
+  } else {
+    this.lines = this.blocks(graphics == GraphicsTrueColor)
+  }
+  return append([]string{}, this.lines...)
+}
+
+// Print returns the picture as written on its own lines from the
+// cursor onwards.
+func (this *Screen) Print(pic *Picture, width, height int) string {
+  lines := pic.Render(width, height, this.Graphics)
+  if this.Graphics < GraphicsKitty {return strings.Join(lines, "\n") + "\n"}
+  // Room is made first, so that the picture does not scroll
+  // the screen under it.
+  return strings.Repeat("\n", pic.rows) +
+    fmt.Sprintf("\x1b[%dA\x1b7", pic.rows) + this.place(pic) +
+    fmt.Sprintf("\x1b8\x1b[%dB", pic.rows)
+}
+
+// blank is the room left for the terminal to draw the picture.
+// Its colour tells pictures apart, so that a page showing another
+// one in the same place is not taken as unchanged.
+func (this *Picture) blank() []string {
+  line := fmt.Sprintf("\x1b[38;5;%dm", this.id % 256) +
+    strings.Repeat(" ", this.cols) + "\x1b[39m"
+  lines := make([]string, this.rows)
+  for i := range lines {lines[i] = line}
+  return lines
+}
+
+// blocks draws two pixels a cell with the upper half block, its
+// foreground the upper pixel and its background the lower one.
+func (this *Picture) blocks(trueColor bool) []string {
+  img := scale(this.Image(), this.cols, this.rows * 2)
+  lines := make([]string, this.rows)
+  for y := range lines {
+    var line strings.Builder
+    last := ""
+    for x := 0; x < this.cols; x++ {
+      top, bottom := img.NRGBAAt(x, 2 * y), img.NRGBAAt(x, 2 * y + 1)
+      fg, bg := sgrColor(top, 38, trueColor), sgrColor(bottom, 48, trueColor)
+      esc, cell := fg + bg, "▀"
+      switch {
+        case top.A < 128 && bottom.A < 128: {esc, cell = "\x1b[39;49m", " "}
+        case bottom.A < 128: {esc = fg + "\x1b[49m"}
+        case top.A < 128: {esc, cell = sgrColor(bottom, 38, trueColor) + "\x1b[49m", "▄"}
+      }
+      if esc != last {line.WriteString(esc)}
+      line.WriteString(cell)
+      last = esc
+    }
+    line.WriteString("\x1b[39;49m")
+    lines[y] = line.String()
+  }
+  return lines
+}
+
+func sgrColor(c color.NRGBA, ground int, trueColor bool) string {
+  if trueColor {
+    return fmt.Sprintf("\x1b[%d;2;%d;%d;%dm", ground, c.R, c.G, c.B)
+  }
+  return fmt.Sprintf("\x1b[%d;5;%dm", ground, xterm256(c))
+}
+
+var cubeLevels = []int{0, 95, 135, 175, 215, 255}
+
+// xterm256 is the nearest colour in the xterm colour cube or its
+// grey ramp.
+func xterm256(c color.NRGBA) int {
+  near := func(v uint8) int {
+    best := 0
+    for i, l := range cubeLevels {
+      if abs(int(v) - l) < abs(int(v) - cubeLevels[best]) {best = i}
+    }
+    return best
+  }
+  r, g, b := near(c.R), near(c.G), near(c.B)
+  cube := 16 + 36 * r + 6 * g + b
+
+  grey := (int(c.R) + int(c.G) + int(c.B)) / 3
+  k := (grey - 3) / 10
+  if k < 0 {k = 0}
+  if k > 23 {k = 23}
+  if colorDistance(c, xtermColor(232 + k)) < colorDistance(c, xtermColor(cube)) {
+    return 232 + k
+  }
+  return cube
+}
+
+// xtermColor is the colour of an index of the cube or grey ramp.
+func xtermColor(i int) color.NRGBA {
+  if i >= 232 {
+    v := uint8(8 + 10 * (i - 232))
+    return color.NRGBA{v, v, v, 255}
+  }
+  i -= 16
+  return color.NRGBA{
+    uint8(cubeLevels[i / 36]),
+    uint8(cubeLevels[i / 6 % 6]),
+    uint8(cubeLevels[i % 6]),
+    255,
+  }
+}
+
+func colorDistance(a, b color.NRGBA) int {
+  dr, dg, db := int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B)
+  return dr * dr + dg * dg + db * db
+}
+
+func abs(n int) int {
+  if n < 0 {return -n}
+  return n
+}
+
+// scale resizes img to w by h pixels, averaging the pixels each
+// one covers. Large areas are sampled rather than read whole.
+func scale(img image.Image, w, h int) *image.NRGBA {
+  b := img.Bounds()
+  res := image.NewNRGBA(image.Rect(0, 0, w, h))
+  for y := 0; y < h; y++ {
+    y0 := b.Min.Y + y * b.Dy() / h
+    y1 := b.Min.Y + (y + 1) * b.Dy() / h
+    if y1 <= y0 {y1 = y0 + 1}
+    sy := (y1 - y0 + 3) / 4
+
+    for x := 0; x < w; x++ {
+      x0 := b.Min.X + x * b.Dx() / w
+      x1 := b.Min.X + (x + 1) * b.Dx() / w
+      if x1 <= x0 {x1 = x0 + 1}
+      sx := (x1 - x0 + 3) / 4
+
+      var r, g, bl, a, n uint64
+      for py := y0; py < y1; py += sy {
+        for px := x0; px < x1; px += sx {
+          cr, cg, cb, ca := img.At(px, py).RGBA()
+          r, g, bl, a = r + uint64(cr), g + uint64(cg), bl + uint64(cb), a + uint64(ca)
+          n++
+        }
+      }
+      if a == 0 {continue}
+      res.SetNRGBA(x, y, color.NRGBA{
+        uint8(r * 255 / a),
+        uint8(g * 255 / a),
+        uint8(bl * 255 / a),
+        uint8(a / n >> 8),
+      })
+    }
+  }
+  return res
+}
+
+// Cols returns the width of the last rendering, in cells.
+func (this *Picture) Cols() int {return this.cols}
+
+// Draw returns the escape sequences drawing the picture at the
+// given row and column, counted from 1, leaving the cursor as it is.
+func (this *Screen) Draw(pic *Picture, row, col int) string {
+  return fmt.Sprintf("\x1b7\x1b[%d;%dH", row, col) + this.place(pic) + "\x1b8"
+}
+
+// place returns the escape sequences drawing the picture at the
+// cursor.
+func (this *Screen) place(pic *Picture) string {
+  var s string
+  switch this.Graphics {
+    case GraphicsKitty: {s = this.kitty(pic)}
+    case GraphicsITerm, GraphicsSixel: {
+      if size := [3]int{pic.cols, pic.rows, this.Graphics}; pic.size != size {
+        pic.data = pic.encode(this.Graphics == GraphicsSixel)
+        pic.size = size
+      }
+      s = pic.data
+    }
+  }
+  return s
+}
+
+func (this *Picture) encode(sixels bool) string {
+  img := scale(this.Image(), this.cols * cellPxWidth, this.rows * cellPxHeight)
+  if sixels {return sixel(img)}
+
+  var buf bytes.Buffer
+  png.Encode(&buf, img)
+  return fmt.Sprintf(
+    "\x1b]1337;File=inline=1;size=%d;width=%d;height=%d;" +
+    "preserveAspectRatio=0:%s\a",
+    buf.Len(), this.cols, this.rows,
+    base64.StdEncoding.EncodeToString(buf.Bytes()),
+  )
+}
+
+// kitty places the picture, sending it first unless kitty already
+// has it in that size.
+func (this *Screen) kitty(pic *Picture) string {
+  key := fmt.Sprintf("%s %dx%d", pic.Href, pic.cols, pic.rows)
+  this.mu.Lock()
+  if this.sent == nil {this.sent = map[string]int{}}
+  id, ok := this.sent[key]
+  if !ok {
+    id = len(this.sent) + 1
+    this.sent[key] = id
+  }
+  this.mu.Unlock()
+  if ok {
+    return fmt.Sprintf(
+      "\x1b_Ga=p,i=%d,c=%d,r=%d,C=1,q=2\x1b\\", id, pic.cols, pic.rows,
+    )
+  }
+
+  var buf bytes.Buffer
+  png.Encode(&buf, scale(pic.Image(), pic.cols * cellPxWidth, pic.rows * cellPxHeight))
+  data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+  var res strings.Builder
+  for first := true; first || data != ""; first = false {
+    chunk := data
+    if len(chunk) > 4096 {chunk = chunk[:4096]}
+    data = data[len(chunk):]
+    more := 0
+    if data != "" {more = 1}
+    if first {
+      fmt.Fprintf(&res, "\x1b_Ga=T,f=100,i=%d,c=%d,r=%d,C=1,q=2,m=%d;%s\x1b\\",
+        id, pic.cols, pic.rows, more, chunk)
+    } else {
+      fmt.Fprintf(&res, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+    }
+  }
+  return res.String()
+}
+
+// sixel encodes img in the colours of the xterm palette, leaving
+// transparent pixels to the background.
+func sixel(img *image.NRGBA) string {
+  w, h := img.Rect.Dx(), img.Rect.Dy()
+  index := make([]int, w * h)
+  used := map[int]bool{}
+  for y := 0; y < h; y++ {
+    for x := 0; x < w; x++ {
+      c := img.NRGBAAt(x, y)
+      i := -1
+      if c.A >= 128 {
+        i = xterm256(c)
+        used[i] = true
+      }
+      index[y * w + x] = i
+    }
+  }
+
+  var res strings.Builder
+  fmt.Fprintf(&res, "\x1bP0;1;0q\"1;1;%d;%d", w, h)
+  for i := 16; i < 256; i++ {
+    if !used[i] {continue}
+    c := xtermColor(i)
+    fmt.Fprintf(&res, "#%d;2;%d;%d;%d", i,
+      int(c.R) * 100 / 255, int(c.G) * 100 / 255, int(c.B) * 100 / 255)
+  }
+
+  for y0 := 0; y0 < h; y0 += 6 {
+    band := map[int]bool{}
+    for y := y0; y < y0 + 6 && y < h; y++ {
+      for _, i := range index[y * w:(y + 1) * w] {
+        if i >= 0 {band[i] = true}
+      }
+    }
+    first := true
+    for c := 16; c < 256; c++ {
+      if !band[c] {continue}
+      if !first {res.WriteByte('$')}
+      first = false
+      fmt.Fprintf(&res, "#%d", c)
+
+      run, last := 0, byte(0)
+      for x := 0; x <= w; x++ {
+        var ch byte
+        if x < w {
+          bits := 0
+          for k := 0; k < 6 && y0 + k < h; k++ {
+            if index[(y0 + k) * w + x] == c {bits |= 1 << k}
+          }
+          ch = byte(63 + bits)
+        }
+        if ch == last && x < w {
+          run++
+          continue
+        }
+        switch {
+          case run > 3: {fmt.Fprintf(&res, "!%d%c", run, last)}
+          case run > 0: {res.WriteString(strings.Repeat(string(last), run))}
+        }
+        run, last = 1, ch
+      }
+    }
+    res.WriteByte('-')
+  }
+  res.WriteString("\x1b\\")
+  return res.String()
+}
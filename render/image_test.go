@@ -0,0 +1,85 @@
+package render
+
+import (
+  "sync"
+  "bytes"
+  "image"
+  "testing"
+  "image/png"
+  "hash/crc32"
+  "image/color"
+  "encoding/binary"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+func testPNG(w, h int) []byte {
+  img := image.NewNRGBA(image.Rect(0, 0, w, h))
+  for y := 0; y < h; y++ {
+    for x := 0; x < w; x++ {img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), 0, 255})}
+  }
+  var buf bytes.Buffer
+  png.Encode(&buf, img)
+  return buf.Bytes()
+}
+
+// Documents of several books are read at once, as by a server.
+func TestConcurrentDocuments(t *testing.T) {
+  files := epub.Memory{
+    "a.xhtml": []byte(`<html><body><p>a</p><img src="a.png"/>
+      <svg><rect width="10" height="10"/></svg></body></html>`),
+    "a.png": testPNG(40, 30),
+  }
+  var wg sync.WaitGroup
+  for i := 0; i < 8; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      docs := Documents(files, []epub.Chapter{{Item: epub.Item{Href: "a.xhtml"}, Lang: "en"}})
+      docs[0].Text(Wrap{Width: 40})
+    }()
+  }
+  wg.Wait()
+}
+
+func TestScreenKitty(t *testing.T) {
+  pic := ReadPicture(epub.Memory{"a.png": testPNG(40, 30)}, "a.png", "")
+  if pic == nil {t.Fatal("no picture")}
+  screen := NewScreen(GraphicsKitty)
+  pic.Render(10, 10, GraphicsKitty)
+  first, again := screen.Draw(pic, 1, 1), screen.Draw(pic, 1, 1)
+  if !bytes.Contains([]byte(first), []byte("a=T")) || bytes.Contains([]byte(again), []byte("a=T")) {
+    t.Errorf("picture not sent once: %.40q, %.40q", first, again)
+  }
+  if other := NewScreen(GraphicsKitty).Draw(pic, 1, 1); !bytes.Contains([]byte(other), []byte("a=T")) {
+    t.Errorf("picture not sent to another screen")
+  }
+}
+
+// A picture is decoded when drawn, once however often the document
+// is loaded, and not at all when too large.
+func TestPictureLazy(t *testing.T) {
+  huge := testPNG(1, 1)
+  binary.BigEndian.PutUint32(huge[16:], 1 << 16)
+  binary.BigEndian.PutUint32(huge[20:], 1 << 16)
+  binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+  files := epub.Memory{
+    "a.xhtml": []byte(`<html><body><img src="a.png"/><img src="b.png"/></body></html>`),
+    "a.png": testPNG(40, 30),
+    "b.png": huge,
+  }
+  if ReadPicture(files, "b.png", "") != nil {t.Error("huge picture read")}
+
+  doc := &Documents(files, []epub.Chapter{{Item: epub.Item{Href: "a.xhtml"}}})[0]
+  doc.Load()
+  for doc.Line() == nil {}
+  pic := doc.pictures["a.png\x00Image"]
+  if pic == nil || pic.image != nil {t.Fatalf("picture not read lazily: %+v", pic)}
+  doc.Lines(0, Wrap{Width: 20}, true)
+  if pic.image == nil {t.Error("picture not decoded when drawn")}
+
+  doc.Close()
+  doc.Load()
+  for doc.Line() == nil {}
+  if doc.pictures["a.png\x00Image"] != pic {t.Error("picture read again")}
+}
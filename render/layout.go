@@ -0,0 +1,288 @@
+package render
+
+import (
+  "fmt"
+  "bytes"
+  "strconv"
+  "strings"
+  "encoding/xml"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+// Block holds the layout of a paragraph beyond wrapping its
+// text, as decided by the elements enclosing it.
+type Block struct {
+  Margin  string  // printed left of every line
+  Marker  string  // replaces Margin on the first line
+  Align   string  // "center" or "right"
+
+  // Render draws paragraphs that are not wrapped text,
+  // such as tables.
+  Render  func(width int) []string
+
+  // Picture is drawn in place of the text, which vertical
+  // lines show instead.
+  Picture *Picture
+}
+
+// margin is the part of a Block added by one enclosing element.
+type margin struct {
+  first string
+  rest  string
+  used  bool
+}
+
+type list struct {
+  ordered bool
+  style   string
+  next    int
+  step    int
+  width   int
+}
+
+var bullets = []string{"•", "◦", "▪"}
+
+// Layout wraps s as told by wrap and prints the margins. Right
+// to left paragraphs are aligned to the right.
+func (this *Block) Layout(s string, wrap Wrap) []string {
+  if wrap.Dir == "" {wrap.Dir = textDir(s)}
+  if this == nil {
+    if wrap.Dir != "rtl" {return wrap.Lines(s)}
+    this = &Block{}
+  }
+
+  var lines []string
+  w := wrap.Width - wrap.width(this.Margin)
+  if w < 1 {w = 1}
+  if this.Picture != nil && !wrap.Vertical {
+    lines = this.Picture.Render(w, wrap.Height, wrap.Graphics)
+  } else if this.Render != nil && wrap.Vertical {
+    lines = this.Render((w + 1) / 2)
+  } else if this.Render != nil {
+    lines = this.Render(w)
+  } else {
+    wrap.Width = w
+    wrap.Justify = wrap.Justify && this.Align == ""
+    lines = wrap.Lines(s)
+  }
+
+  align := this.Align
+  if align == "" && wrap.Dir == "rtl" && this.Render == nil {align = "right"}
+  for i, v := range lines {
+    space := w - wrap.width(v)
+    if wrap.Vertical {space /= 2}
+    switch {
+      case space <= 0: {}
+      case align == "center": {v = strings.Repeat(" ", space / 2) + v}
+      case align == "right": {v = strings.Repeat(" ", space) + v}
+    }
+    if i == 0 {
+      lines[i] = this.Marker + v
+    } else {
+      lines[i] = this.Margin + v
+    }
+  }
+  return lines
+}
+
+// block returns the layout for a paragraph starting at the
+// current position, handing out pending list markers.
+func (this *Document) block() *Block {
+  style := this.style()
+  align := this.align
+  if align == "" {align = style.align}
+  margin := this.cssMargin()
+  indent := margin + style.indent
+  if indent < 0 {indent = 0}
+  if len(this.margins) == 0 && align == "" && indent == 0 && margin == 0 {
+    return nil
+  }
+
+  b := &Block{Align: align}
+  for _, m := range this.margins {
+    b.Margin += m.rest
+    if m.used {
+      b.Marker += m.rest
+    } else {
+      b.Marker += m.first
+      m.used = true
+    }
+  }
+  b.Margin += strings.Repeat(" ", margin)
+  b.Marker += strings.Repeat(" ", indent)
+  return b
+}
+
+// newParagraph ends the current paragraph unless it is empty,
+// reporting whether it did.
+func (this *Document) newParagraph() bool {
+  if this.content[this.Offset] == "" {return false}
+  this.Offset++
+  return true
+}
+
+func (this *Document) pushMargin(first, rest string) {
+  this.margins = append(this.margins, &margin{first: first, rest: rest})
+}
+
+func (this *Document) popMargin() {
+  if len(this.margins) > 0 {
+    this.margins = this.margins[:len(this.margins) - 1]
+  }
+}
+
+// write adds s to the current paragraph, after the escape
+// sequences of the styles in effect.
+func (this *Document) write(s string) {
+  o := this.Offset
+  if this.content[o] == "" && this.blocks[o] == nil {
+    this.blocks[o] = this.block()
+    if this.lang != "" {this.langs[o] = this.lang}
+    if this.dir != "" {this.dirs[o] = this.dir}
+  }
+  if this.content[o] == "" {
+    s = this.style().escapes() + s
+  } else {
+    s = this.pending + s
+  }
+  this.pending = ""
+  this.content[o] += s
+}
+
+// putBlock places a paragraph drawn by render after the
+// current one, moving the offset past it.
+func (this *Document) putBlock(render func(int) []string) *Block {
+  if this.content[this.Offset] != "" {this.Offset++}
+
+  b := this.block()
+  if b == nil {b = &Block{}}
+  b.Render = render
+  this.blocks[this.Offset] = b
+  this.Offset++
+  return b
+}
+
+// putPicture places a picture as a paragraph of its own, with
+// text to show in its place in vertical lines.
+func (this *Document) putPicture(pic *Picture, text string) {
+  this.putBlock(nil).Picture = pic
+  this.content[this.Offset - 1] = text
+}
+
+func (this *Document) startList(token xml.StartElement) {
+  l := &list{
+    ordered: token.Name.Local == "ol",
+    style: epub.AttrValue(token, "type"),
+    next: 1,
+    step: 1,
+  }
+  this.lists = append(this.lists, l)
+
+  if !l.ordered {
+    l.width = 2
+    return
+  }
+
+  count := this.countItems()
+  _, reversed := attrLookup(token, "reversed")
+  if reversed {
+    l.step = -1
+    l.next = count
+  }
+  if n, err := strconv.Atoi(epub.AttrValue(token, "start")); err == nil {
+    l.next = n
+  }
+
+  for i := 0; i < count || i == 0; i++ {
+    w := len(listNumber(l.next + l.step * i, l.style))
+    if w > l.width {l.width = w}
+  }
+  l.width += 2
+}
+
+func (this *Document) endList() {
+  if len(this.lists) > 0 {
+    this.lists = this.lists[:len(this.lists) - 1]
+  }
+}
+
+func (this *Document) startItem(token xml.StartElement) {
+  var l *list
+  if len(this.lists) > 0 {
+    l = this.lists[len(this.lists) - 1]
+  } else {
+    l = &list{width: 2}
+  }
+
+  marker := bullets[0]
+  if len(this.lists) > 0 {
+    marker = bullets[(len(this.lists) - 1) % len(bullets)]
+  }
+  if l.ordered {
+    if n, err := strconv.Atoi(epub.AttrValue(token, "value")); err == nil {
+      l.next = n
+    }
+    marker = listNumber(l.next, l.style) + "."
+    l.next += l.step
+  }
+
+  this.pushMargin(
+    fmt.Sprintf("%*s ", l.width - 1, marker),
+    strings.Repeat(" ", l.width),
+  )
+}
+
+// countItems looks ahead for the number of items in the list
+// the decoder has just entered.
+func (this *Document) countItems() (count int) {
+  offset := this.offset()
+  if offset > int64(len(this.source)) {return}
+  d := epub.NewDecoder(bytes.NewReader(this.source[offset:]))
+
+  depth := 0
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    switch token := t.(type) {
+      case xml.StartElement: {
+        if depth == 0 && token.Name.Local == "li" {count++}
+        depth++
+      }
+      case xml.EndElement: {
+        if depth == 0 {return}
+        depth--
+      }
+    }
+  }
+  return
+}
+
+func listNumber(n int, style string) string {
+  switch style {
+    case "a": {return alphaNumber(n, 'a')}
+    case "A": {return alphaNumber(n, 'A')}
+    case "i": {return strings.ToLower(romanNumber(n))}
+    case "I": {return romanNumber(n)}
+  }
+  return strconv.Itoa(n)
+}
+
+func alphaNumber(n int, base byte) string {
+  if n < 1 {return strconv.Itoa(n)}
+  var res []byte
+  for ; n > 0; n = (n - 1) / 26 {
+    res = append([]byte{base + byte((n - 1) % 26)}, res...)
+  }
+  return string(res)
+}
+
+func romanNumber(n int) (res string) {
+  if n < 1 || n >= 4000 {return strconv.Itoa(n)}
+  values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+  digits := []string{
+    "M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I",
+  }
+  for i, v := range values {
+    for ; n >= v; n -= v {res += digits[i]}
+  }
+  return
+}
@@ -0,0 +1,116 @@
+package render
+
+import "unicode"
+
+// Line breaking classes of UAX #14, reduced to the ones that
+// change where levt may wrap a line.
+const (
+  lbAL = iota  // letters, digits and everything else
+  lbSP         // space
+  lbGL         // no-break space and word joiners
+  lbZW         // zero width space
+  lbBA         // break after: hyphens, dashes
+  lbB2         // break on both sides: em dash
+  lbOP         // opening punctuation and quotes
+  lbCL         // closing punctuation, stops and small kana
+  lbID         // ideographs, kana, hangul, full width forms
+  lbSA         // Thai, Lao, Khmer and Myanmar
+  lbSY         // solidus
+)
+
+func lineBreakClass(r rune) int {
+  switch r {
+    case ' ', '\t': {return lbSP}
+    case 0x00A0, 0x202F, 0x2007, 0x2060, 0xFEFF, 0x2011: {return lbGL}
+    case 0x200B: {return lbZW}
+    case '-', 0x2010, 0x2012, 0x2013, 0x00AD: {return lbBA}
+    case 0x2014, 0x2E3A, 0x2E3B: {return lbB2}
+    case '/': {return lbSY}
+    case '(', '[', '{', 0x00AB, 0x2018, 0x201C, 0x201E, 0x00BF, 0x00A1: {
+      return lbOP
+    }
+    case ')', ']', '}', 0x00BB, 0x2019, 0x201D, '!', '?', ',', '.', ':',
+      ';', '%', 0x2026, 0x2025, 0x30FC, 0x30FB, 0x309D, 0x309E, 0x30FD,
+      0x30FE, 0x3005, 0x303B, 0xFF1F, 0xFF01, 0xFF0C, 0xFF0E, 0xFF1A,
+      0xFF1B, 0xFF05, 0xFF65, 0x0E2F, 0x0E46, 0x0EAF, 0x0EC6, 0x17D4,
+      0x17D5, 0x104A, 0x104B: {
+      return lbCL
+    }
+  }
+
+  switch {
+    // CJK brackets come in open/close pairs from U+3008 to U+301B.
+    case r >= 0x3008 && r <= 0x3011, r >= 0x3014 && r <= 0x301B: {
+      if r % 2 == 0 {return lbOP}
+      return lbCL
+    }
+    case r == 0x3001, r == 0x3002: {return lbCL}
+    case r == 0xFF08, r == 0xFF3B, r == 0xFF5B, r == 0xFF62: {return lbOP}
+    case r == 0xFF09, r == 0xFF3D, r == 0xFF5D, r == 0xFF63: {return lbCL}
+    case isSmallKana(r): {return lbCL}
+    case r >= 0x0E00 && r <= 0x0EFF, r >= 0x1000 && r <= 0x109F,
+      r >= 0x1780 && r <= 0x17FF, r >= 0x19E0 && r <= 0x19FF: {
+      return lbSA
+    }
+    case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana,
+      unicode.Hangul, unicode.Yi),
+      r >= 0x3000 && r <= 0x303F, r >= 0xFF01 && r <= 0xFF60,
+      r >= 0x1F300 && r <= 0x1FAFF: {
+      return lbID
+    }
+  }
+  return lbAL
+}
+
+func isSmallKana(r rune) bool {
+  switch r {
+    case 'ぁ', 'ぃ', 'ぅ', 'ぇ', 'ぉ', 'っ', 'ゃ', 'ゅ', 'ょ', 'ゎ', 'ゕ', 'ゖ',
+      'ァ', 'ィ', 'ゥ', 'ェ', 'ォ', 'ッ', 'ャ', 'ュ', 'ョ', 'ヮ', 'ヵ', 'ヶ': {
+      return true
+    }
+  }
+  return r >= 0x31F0 && r <= 0x31FF
+}
+
+// Thai and Lao vowels written before the consonant they follow
+// in speech; a line never ends on one.
+func isLeadingVowel(r rune) bool {
+  return r >= 0x0E40 && r <= 0x0E44 || r >= 0x0EC0 && r <= 0x0EC4
+}
+
+// canBreak reports whether a line may be broken between a
+// grapheme starting with a and the next one starting with b.
+// Scripts without spaces such as Thai have no dictionary here,
+// so breaks are placed around syllable boundaries that can be
+// told from the letters alone.
+func canBreak(a, b rune) bool {
+  ca, cb := lineBreakClass(a), lineBreakClass(b)
+  switch {
+    case cb == lbSP: {return false}
+    case ca == lbZW: {return true}
+    case ca == lbGL, cb == lbGL, cb == lbZW: {return false}
+    case cb == lbCL: {return false}
+    case ca == lbOP: {return false}
+    case ca == lbSP: {return true}
+    case ca == lbB2 && cb == lbB2: {return false}
+    case ca == lbB2, cb == lbB2: {return true}
+    case ca == lbBA, ca == lbSY: {
+      return cb == lbAL && !unicode.IsDigit(b) || cb == lbID
+    }
+    case cb == lbOP: {return ca == lbID || ca == lbCL}
+    case ca == lbID || cb == lbID: {return true}
+    case ca == lbSA && cb == lbSA: {
+      if isLeadingVowel(a) {return false}
+      return isLeadingVowel(b) || a == 0x0E30 || a == 0x0E33 ||
+        a == 0x0EB0 || a == 0x0EB3
+    }
+  }
+  return false
+}
+
+// canForce reports whether a line too long for any regular break
+// may be cut between the two graphemes.
+func canForce(a, b rune) bool {
+  if isLeadingVowel(a) {return false}
+  return lineBreakClass(b) != lbCL && lineBreakClass(a) != lbOP
+}
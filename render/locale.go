@@ -0,0 +1,66 @@
+package render
+
+import "strings"
+
+const (
+  quoteRule = "  \x1b[2m│\x1b[22m "
+  asideRule = "  \x1b[2m┆\x1b[22m "
+)
+
+// Opening and closing marks for quotations and for quotations
+// nested in them.
+var quoteMarks = map[string][4]string{
+  "en": {"“", "”", "‘", "’"},
+  "de": {"„", "“", "‚", "‘"},
+  "fr": {"« ", " »", "“", "”"},
+  "es": {"«", "»", "“", "”"},
+  "it": {"«", "»", "“", "”"},
+  "pt": {"“", "”", "‘", "’"},
+  "pt-pt": {"«", "»", "“", "”"},
+  "nl": {"“", "”", "‘", "’"},
+  "pl": {"„", "”", "«", "»"},
+  "cs": {"„", "“", "‚", "‘"},
+  "sk": {"„", "“", "‚", "‘"},
+  "hu": {"„", "”", "»", "«"},
+  "ru": {"«", "»", "„", "“"},
+  "uk": {"«", "»", "„", "“"},
+  "be": {"«", "»", "„", "“"},
+  "el": {"«", "»", "“", "”"},
+  "sv": {"”", "”", "’", "’"},
+  "fi": {"”", "”", "’", "’"},
+  "da": {"»", "«", "›", "‹"},
+  "no": {"«", "»", "‘", "’"},
+  "nb": {"«", "»", "‘", "’"},
+  "tr": {"“", "”", "‘", "’"},
+  "he": {"”", "”", "’", "’"},
+  "ar": {"«", "»", "‹", "›"},
+  "fa": {"«", "»", "‹", "›"},
+  "ja": {"「", "」", "『", "』"},
+  "zh": {"“", "”", "‘", "’"},
+  "zh-tw": {"「", "」", "『", "』"},
+  "zh-hk": {"「", "」", "『", "』"},
+  "zh-hant": {"「", "」", "『", "』"},
+  "ko": {"“", "”", "‘", "’"},
+}
+
+// langMatch looks up the entry for a language tag such as
+// "pt-BR", falling back to its primary subtag.
+func langMatch(lang string) string {
+  lang = strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+  for lang != "" {
+    if _, ok := quoteMarks[lang]; ok {return lang}
+    i := strings.LastIndex(lang, "-")
+    if i < 0 {break}
+    lang = lang[:i]
+  }
+  return lang
+}
+
+// quoteMark returns the opening (side 0) or closing (side 1)
+// quotation mark for a quote nested depth levels deep.
+func quoteMark(lang string, depth, side int) string {
+  marks, ok := quoteMarks[langMatch(lang)]
+  if !ok {marks = quoteMarks["en"]}
+  if depth < 0 {depth = 0}
+  return marks[(depth % 2) * 2 + side]
+}
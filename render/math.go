@@ -0,0 +1,314 @@
+package render
+
+import (
+  "strings"
+  "unicode"
+  "encoding/xml"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+// mathNode is a MathML element with its children, or a run of
+// text when name is empty.
+type mathNode struct {
+  name     string
+  attrs    []xml.Attr
+  text     string
+  children []*mathNode
+}
+
+// Operators printed with a space on both sides.
+var mathSpaced = map[string]bool{
+  "=": true, "+": true, "-": true, "−": true, "<": true, ">": true,
+  "≤": true, "≥": true, "≠": true, "≈": true, "≡": true, "×": true,
+  "÷": true, "±": true, "∓": true, "→": true, "←": true, "↔": true,
+  "⇒": true, "⇔": true, "∈": true, "∉": true, "⊂": true, "⊆": true,
+  "∪": true, "∩": true, "∧": true, "∨": true, "∼": true, "≅": true,
+  ":=": true, "·": true, "∘": true, "⋅": true,
+}
+
+// Accents set over a single character, as combining marks.
+var mathAccents = map[string]string{
+  "¯": "\u0305", "‾": "\u0305", "_": "\u0305", "^": "\u0302",
+  "ˆ": "\u0302", "~": "\u0303", "˜": "\u0303", "→": "\u20D7",
+  "\u20D7": "\u20D7", "˙": "\u0307", ".": "\u0307", "¨": "\u0308",
+  "ˇ": "\u030C",
+}
+
+// ReadMath consumes a <math> element and returns it as a line of
+// text, using its alttext when it has one.
+func ReadMath(d *xml.Decoder, token xml.StartElement) string {
+  if alt := strings.TrimSpace(epub.AttrValue(token, "alttext")); alt != "" {
+    d.Skip()
+    return alt
+  }
+  root := readMathNode(d, token)
+  text := strings.TrimSpace(root.linear())
+  if text == "" {text = root.annotation()}
+  return text
+}
+
+func readMathNode(d *xml.Decoder, token xml.StartElement) *mathNode {
+  node := &mathNode{name: token.Name.Local, attrs: token.Attr}
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    switch token := t.(type) {
+      case xml.CharData: {
+        text := newLineRe.ReplaceAllString(string(token), " ")
+        node.children = append(node.children, &mathNode{text: text})
+      }
+      case xml.StartElement: {
+        node.children = append(node.children, readMathNode(d, token))
+      }
+      case xml.EndElement: {return node}
+    }
+  }
+  return node
+}
+
+// elements returns the child elements, leaving out text between them.
+func (this *mathNode) elements() (res []*mathNode) {
+  for _, v := range this.children {
+    if v.name != "" {res = append(res, v)}
+  }
+  return
+}
+
+func (this *mathNode) arg(i int) *mathNode {
+  e := this.elements()
+  if i < len(e) {return e[i]}
+  return &mathNode{name: "mrow"}
+}
+
+func (this *mathNode) attr(name string) (string, bool) {
+  for _, a := range this.attrs {
+    if a.Name.Local == name {return a.Value, true}
+  }
+  return "", false
+}
+
+func (this *mathNode) content() string {
+  var res strings.Builder
+  for _, v := range this.children {
+    if v.name == "" {
+      res.WriteString(v.text)
+    } else {
+      res.WriteString(v.content())
+    }
+  }
+  return strings.TrimSpace(res.String())
+}
+
+// annotation finds the text of the first annotation, such as the
+// TeX source of the formula.
+func (this *mathNode) annotation() string {
+  if this.name == "annotation" {return this.content()}
+  for _, v := range this.elements() {
+    if s := v.annotation(); s != "" {return s}
+  }
+  return ""
+}
+
+// atomic reports whether the node prints as one unit that needs
+// no parentheses as part of a fraction, power or root.
+func (this *mathNode) atomic() bool {
+  switch this.name {
+    case "mi", "mn", "mtext", "msqrt", "mroot", "mfenced": {return true}
+    case "msup", "msub", "msubsup", "mover", "munder": {
+      return this.arg(0).atomic()
+    }
+    case "mrow", "mstyle", "semantics", "mpadded", "math": {
+      e := this.elements()
+      if this.name == "semantics" && len(e) > 0 {return e[0].atomic()}
+      if len(e) == 1 {return e[0].atomic()}
+      if len(e) >= 2 && isFence(e[0]) && isFence(e[len(e) - 1]) {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+func isFence(n *mathNode) bool {
+  if n.name != "mo" {return false}
+  switch n.content() {
+    case "(", ")", "[", "]", "{", "}", "|", "‖", "⟨", "⟩": {return true}
+  }
+  return false
+}
+
+func isClosing(n *mathNode) bool {
+  switch n.content() {
+    case ")", "]", "}", "|", "‖", "⟩", "!", "′", "″": {return true}
+  }
+  return false
+}
+
+// group prints a node, in parentheses unless it is atomic.
+func (this *mathNode) group() string {
+  s := this.linear()
+  if this.atomic() || len([]rune(s)) <= 1 {return s}
+  return "(" + s + ")"
+}
+
+func (this *mathNode) linear() string {
+  e := this.elements()
+  switch this.name {
+    case "": {return this.text}
+    case "annotation", "annotation-xml", "none", "mprescripts": {
+      return ""
+    }
+    case "mi", "mn", "ms": {return this.content()}
+    case "mtext": {return this.spacedText()}
+    case "mspace": {return " "}
+    case "mphantom": {return strings.Repeat(" ", len([]rune(this.content())))}
+    case "mo": {
+      op := this.content()
+      if op == "," || op == ";" {return op + " "}
+      if mathSpaced[op] {return " " + op + " "}
+      return op
+    }
+    case "semantics": {
+      if len(e) > 0 {return e[0].linear()}
+      return ""
+    }
+    case "mfrac": {
+      num, den := this.arg(0), this.arg(1)
+      if t, _ := this.attr("linethickness"); t == "0" || t == "0px" {
+        return "(" + num.linear() + " over " + den.linear() + ")"
+      }
+      return num.group() + "/" + den.group()
+    }
+    case "msup": {return this.arg(0).group() + this.arg(1).script(true)}
+    case "msub": {return this.arg(0).group() + this.arg(1).script(false)}
+    case "msubsup": {
+      return this.arg(0).group() +
+        this.arg(1).script(false) +
+        this.arg(2).script(true)
+    }
+    case "mover", "munder", "munderover": {
+      base := this.arg(0).linear()
+      over := this.arg(1)
+      if this.name == "munderover" {over = this.arg(2)}
+      if mark, ok := mathAccents[over.content()]; ok &&
+        this.name == "mover" && len([]rune(base)) == 1 {
+        return base + mark
+      }
+      res := this.arg(0).group()
+      if this.name != "mover" {res += this.arg(1).script(false)}
+      if this.name != "munder" {res += over.script(true)}
+      return res
+    }
+    case "mmultiscripts": {
+      res := ""
+      pre := false
+      for i, v := range e {
+        switch {
+          case v.name == "mprescripts": {pre = true}
+          case i == 0: {res = v.group()}
+          case pre: {res = v.script(i % 2 == 0) + res}
+          default: {res += v.script(i % 2 == 0)}
+        }
+      }
+      return res
+    }
+    case "msqrt": {
+      arg := &mathNode{name: "mrow", children: this.children}
+      return "√" + arg.group()
+    }
+    case "mroot": {
+      return this.arg(1).script(true) + "√" + this.arg(0).group()
+    }
+    case "mfenced": {
+      open, ok := this.attr("open")
+      if !ok {open = "("}
+      close, ok := this.attr("close")
+      if !ok {close = ")"}
+      sep, ok := this.attr("separators")
+      if !ok {sep = ","}
+      seps := []rune(strings.Join(strings.Fields(sep), ""))
+
+      if len(e) == 1 && e[0].name == "mtable" {
+        return open + e[0].rows() + close
+      }
+
+      var res strings.Builder
+      res.WriteString(open)
+      for i, v := range e {
+        if i > 0 && len(seps) > 0 {
+          s := seps[len(seps) - 1]
+          if i - 1 < len(seps) {s = seps[i - 1]}
+          res.WriteString(string(s) + " ")
+        }
+        res.WriteString(v.linear())
+      }
+      res.WriteString(close)
+      return res.String()
+    }
+    case "mtable": {return "[" + this.rows() + "]"}
+  }
+
+  // Signs opening a row or following an operator are prefixes,
+  // as in -b, and get no spaces.
+  var res strings.Builder
+  for i, v := range e {
+    if v.name == "mo" && mathSpaced[v.content()] &&
+      (i == 0 || e[i - 1].name == "mo" && !isClosing(e[i - 1])) {
+      res.WriteString(v.content())
+      continue
+    }
+    res.WriteString(v.linear())
+  }
+  return collapseSpaces(res.String())
+}
+
+// rows prints a table as its rows separated by semicolons.
+func (this *mathNode) rows() string {
+  var rows []string
+  for _, row := range this.elements() {
+    var cells []string
+    for _, cell := range row.elements() {
+      cells = append(cells, strings.TrimSpace(cell.linear()))
+    }
+    if row.name == "mlabeledtr" && len(cells) > 0 {cells = cells[1:]}
+    if row.name != "mtr" && row.name != "mlabeledtr" {
+      cells = []string{strings.TrimSpace(row.linear())}
+    }
+    rows = append(rows, strings.Join(cells, "  "))
+  }
+  return strings.Join(rows, "; ")
+}
+
+// script prints a node as a super- or subscript, closing up the
+// spaces around its operators.
+func (this *mathNode) script(sup bool) string {
+  return scriptText(strings.ReplaceAll(this.linear(), " ", ""), sup)
+}
+
+// spacedText is the text of a node with its spaces kept.
+func (this *mathNode) spacedText() string {
+  var res strings.Builder
+  for _, v := range this.children {
+    if v.name == "" {
+      res.WriteString(v.text)
+    } else {
+      res.WriteString(v.linear())
+    }
+  }
+  return res.String()
+}
+
+func collapseSpaces(s string) string {
+  var res strings.Builder
+  space := false
+  for _, r := range s {
+    if unicode.IsSpace(r) {
+      space = true
+      continue
+    }
+    if space && res.Len() > 0 {res.WriteRune(' ')}
+    space = false
+    res.WriteRune(r)
+  }
+  if space {res.WriteRune(' ')}
+  return res.String()
+}
@@ -0,0 +1,29 @@
+package render
+
+import (
+  "strings"
+  "testing"
+  "encoding/xml"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+func TestReadMath(t *testing.T) {
+  for src, want := range map[string]string{
+    `<math><mfrac><mi>a</mi><mn>2</mn></mfrac></math>`: "a/2",
+    `<math><msup><mi>x</mi><mn>2</mn></msup><mo>+</mo><mn>1</mn></math>`: "x² + 1",
+    `<math><msqrt><mi>x</mi><mo>+</mo><mn>1</mn></msqrt></math>`: "√(x + 1)",
+    `<math><msub><mi>a</mi><mi>i</mi></msub><mo>=</mo><mover><mi>x</mi><mo>¯</mo></mover></math>`: "aᵢ = x̅",
+    `<math alttext="E=mc^2"><mi>E</mi></math>`: "E=mc^2",
+  } {
+    d := epub.NewDecoder(strings.NewReader(src + "<p>after</p>"))
+    t0, _ := d.Token()
+    if got := ReadMath(d, t0.(xml.StartElement)); got != want {
+      t.Errorf("%s: %q, want %q", src, got, want)
+    }
+    // The decoder is left after the element.
+    if t1, _ := d.Token(); t1 == nil || t1.(xml.StartElement).Name.Local != "p" {
+      t.Errorf("%s: decoder left at %v", src, t1)
+    }
+  }
+}
@@ -0,0 +1,131 @@
+package render
+
+import (
+  "regexp"
+  "strings"
+  "encoding/xml"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+const NamespaceOPS = "http://www.idpf.org/2007/ops"
+
+// Fragments used by EPUB2 books, which have no epub:type,
+// for links to footnotes: #fn1, #ftn12, #footnote-3, #note_7 …
+var noteIdRe *regexp.Regexp = regexp.MustCompile(
+  `(?i)^(_?ftn|fn|footnote|endnote|rearnote|note|en)[-_.:]?\d+$`,
+)
+
+var noteTypes = []string{"footnote", "endnote", "rearnote", "note"}
+
+// Classes of links to notes, as pandoc, calibre and others write
+// them. Links back from the note, as "footnote-backref", are not.
+var noteClasses = []string{
+  "noteref", "footnote", "footnote-ref", "footnote-reference",
+  "footnoteref", "fnref", "note-ref", "endnote-ref",
+}
+
+func epubType(token xml.StartElement) string {
+  for _, attr := range token.Attr {
+    space := attr.Name.Space
+    if attr.Name.Local == "type" && (space == NamespaceOPS || space == "epub") {
+      return attr.Value
+    }
+  }
+  return ""
+}
+
+// isNoteref reports whether the anchor links to a footnote.
+func isNoteref(token xml.StartElement) bool {
+  if epub.HasToken(epubType(token), "noteref") {return true}
+
+  class := strings.ToLower(epub.AttrValue(token, "class"))
+  for _, v := range noteClasses {
+    if epub.HasToken(class, v) {return true}
+  }
+
+  split := strings.SplitN(epub.AttrValue(token, "href"), "#", 2)
+  return len(split) == 2 && noteIdRe.MatchString(split[1])
+}
+
+// isNote reports whether the element only holds a note and
+// should be left out of the reading flow.
+func isNote(token xml.StartElement) bool {
+  if token.Name.Local != "aside" {return false}
+  t := epubType(token)
+  for _, v := range noteTypes {
+    if epub.HasToken(t, v) {return true}
+  }
+  return false
+}
+
+var inlineElements = map[string]bool{
+  "a": true, "span": true, "sup": true, "sub": true, "small": true,
+  "b": true, "strong": true, "i": true, "em": true,
+}
+
+type noteFrame struct {
+  name    string
+  text    strings.Builder
+  target  bool
+}
+
+// NoteText returns the paragraphs of the note the link points to.
+// When the id is on an inline element, as in
+// <p><a id="fn1">1</a> text</p>, the enclosing block is used.
+func NoteText(files epub.Resources, link string) []string {
+  split := strings.SplitN(link, "#", 2)
+  if len(split) < 2 || split[1] == "" {return nil}
+
+  reader, err := files.Open(split[0])
+  if err != nil {return nil}
+  defer reader.Close()
+
+  var stack []*noteFrame
+  d := epub.NewDecoder(reader)
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    switch token := t.(type) {
+      case xml.CharData: {
+        if len(stack) > 0 {
+          stack[len(stack) - 1].text.Write(token)
+        }
+      }
+
+      case xml.StartElement: {
+        f := &noteFrame{name: token.Name.Local}
+        stack = append(stack, f)
+        if epub.AttrValue(token, "id") != split[1] &&
+          epub.AttrValue(token, "name") != split[1] {continue}
+
+        for i := len(stack) - 1; i >= 0; i-- {
+          if i == 0 || !inlineElements[stack[i].name] {
+            stack[i].target = true
+            break
+          }
+        }
+      }
+
+      case xml.EndElement: {
+        if len(stack) == 0 {return nil}
+        f := stack[len(stack) - 1]
+        stack = stack[:len(stack) - 1]
+        if f.target {return noteParagraphs(f.text.String())}
+
+        if len(stack) > 0 {
+          parent := &stack[len(stack) - 1].text
+          parent.WriteString(f.text.String())
+          if !inlineElements[f.name] {parent.WriteString("\n")}
+        }
+      }
+    }
+  }
+  return nil
+}
+
+func noteParagraphs(text string) (res []string) {
+  for _, v := range strings.Split(text, "\n") {
+    v = strings.Join(strings.Fields(v), " ")
+    if v != "" {res = append(res, v)}
+  }
+  return
+}
@@ -0,0 +1,32 @@
+package render
+
+import (
+  "testing"
+  "encoding/xml"
+)
+
+func TestIsNoteref(t *testing.T) {
+  for _, c := range []struct {
+    class, href string
+    want        bool
+  }{
+    {"footnote-ref", "#x", true},
+    {"calibre noteref", "#x", true},
+    {"footnote", "#x", true},
+    {"footnote-backref", "#fnref1", false},
+    {"footnote-return", "#ref3", false},
+    {"footnotes-link", "ch2.xhtml", false},
+    {"", "notes.xhtml#fn12", true},
+  } {
+    token := xml.StartElement{
+      Name: xml.Name{Local: "a"},
+      Attr: []xml.Attr{
+        {Name: xml.Name{Local: "class"}, Value: c.class},
+        {Name: xml.Name{Local: "href"}, Value: c.href},
+      },
+    }
+    if got := isNoteref(token); got != c.want {
+      t.Errorf("%q %q: %v, want %v", c.class, c.href, got, c.want)
+    }
+  }
+}
@@ -0,0 +1,122 @@
+package render
+
+import (
+  "bytes"
+)
+
+// fix is text put into the source to repair it, kept so that
+// diagnostics give the columns of the source as it was.
+type fix struct {
+  at      int64  // offset in the repaired source
+  n       int64  // bytes put in
+  element string
+  err     string
+}
+
+// repairMarkup quotes attribute values written without quotes and
+// escapes the < that start no tag, as browsers read them. The
+// decoder takes both as syntax errors, losing the attributes or
+// the text after them.
+func repairMarkup(src []byte) ([]byte, []fix) {
+  var out []byte
+  var fixes []fix
+  i := 0
+
+  // copyTo copies the source up to and including end, or all of it.
+  copyTo := func(end string) {
+    j := bytes.Index(src[i:], []byte(end))
+    if j < 0 {j = len(src) - i} else {j += len(end)}
+    out = append(out, src[i:i + j]...)
+    i += j
+  }
+  space := func() {
+    for i < len(src) && isSpace(src[i]) {
+      out = append(out, src[i])
+      i++
+    }
+  }
+
+  for i < len(src) {
+    rest := src[i:]
+    switch {
+      case rest[0] != '<': {
+        out = append(out, rest[0])
+        i++
+      }
+      case bytes.HasPrefix(rest, []byte("<!--")): {copyTo("-->")}
+      case bytes.HasPrefix(rest, []byte("<![CDATA[")): {copyTo("]]>")}
+      case bytes.HasPrefix(rest, []byte("<!")), bytes.HasPrefix(rest, []byte("<?")): {
+        copyTo(">")
+      }
+      case bytes.HasPrefix(rest, []byte("</")): {copyTo(">")}
+      case len(rest) > 1 && isNameStart(rest[1]): {
+        start := i
+        i++
+        for i < len(src) && !isSpace(src[i]) && src[i] != '>' && src[i] != '/' {i++}
+        name := string(bytes.ToLower(src[start + 1:i]))
+        out = append(out, src[start:i]...)
+
+        // The attributes, up to the end of the tag.
+        for {
+          space()
+          if i >= len(src) || src[i] == '>' || bytes.HasPrefix(src[i:], []byte("/>")) {break}
+          for i < len(src) && !isSpace(src[i]) && src[i] != '=' && src[i] != '>' &&
+            !bytes.HasPrefix(src[i:], []byte("/>")) {
+            out = append(out, src[i])
+            i++
+          }
+          space()
+          if i >= len(src) || src[i] != '=' {continue}
+          out = append(out, '=')
+          i++
+          space()
+          if i >= len(src) {break}
+          if q := src[i]; q == '"' || q == '\'' {
+            j := bytes.IndexByte(src[i + 1:], q)
+            if j < 0 {j = len(src) - i - 2}
+            out = append(out, src[i:i + j + 2]...)
+            i += j + 2
+            continue
+          }
+          at, from := len(out), i
+          out = append(out, '"')
+          for i < len(src) && !isSpace(src[i]) && src[i] != '>' &&
+            !bytes.HasPrefix(src[i:], []byte("/>")) {
+            if src[i] == '"' {out = append(out, "&quot;"...)} else {out = append(out, src[i])}
+            i++
+          }
+          out = append(out, '"')
+          n := int64(len(out) - at - (i - from))
+          fixes = append(fixes, fix{int64(at), n, name, "attribute value without quotes"})
+        }
+        if i < len(src) && src[i] == '/' {
+          out = append(out, '/')
+          i++
+        }
+        if i < len(src) {
+          out = append(out, src[i])
+          i++
+        }
+
+        // The text of scripts and styles is left as it is.
+        if (name == "script" || name == "style") && !bytes.HasSuffix(out, []byte("/>")) {
+          copyTo("</")
+        }
+      }
+      default: {
+        fixes = append(fixes, fix{int64(len(out)), 3, "", "< not escaped"})
+        out = append(out, "&lt;"...)
+        i++
+      }
+    }
+  }
+  return out, fixes
+}
+
+func isSpace(c byte) bool {
+  return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isNameStart(c byte) bool {
+  return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || c >= 0x80
+}
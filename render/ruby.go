@@ -0,0 +1,127 @@
+package render
+
+import (
+  "regexp"
+  "strings"
+)
+
+// Ruby modes: readings on a line above their base text, in
+// parentheses after it, or left out.
+const (
+  RubyAbove = iota
+  RubyInline
+  RubyHidden
+)
+
+var RubyModes = []string{"above", "inline", "hidden"}
+
+// Ruby is kept in the content with the interlinear annotation
+// characters, as base, separator, reading and terminator.
+const (
+  rubyStart = '\uFFF9'
+  rubySep   = '\uFFFA'
+  rubyEnd   = '\uFFFB'
+)
+
+// States of the ruby being read in Line.
+const (
+  rubyNone = iota
+  rubyBase
+  rubyText
+  rubyBetween
+)
+
+var rubyRe = regexp.MustCompile(
+  "\uFFF9([^\uFFFA]*)\uFFFA([^\uFFFB]*)\uFFFB",
+)
+
+// rubyInline puts the readings of s in parentheses after their
+// base, or leaves them out, keeping any escape sequences.
+func rubyInline(s string, mode int) string {
+  if !strings.ContainsRune(s, rubyStart) {return s}
+  return rubyRe.ReplaceAllStringFunc(s, func(m string) string {
+    sub := rubyRe.FindStringSubmatch(m)
+    text := sgrRe.ReplaceAllString(sub[2], "")
+    if mode == RubyHidden || text == "" {
+      return sub[1] + strings.Join(sgrRe.FindAllString(sub[2], -1), "")
+    }
+    if TextWidth(text) < 2 * len([]rune(text)) {
+      return sub[1] + "(" + sub[2] + ")"
+    }
+    return sub[1] + "（" + sub[2] + "）"
+  })
+}
+
+// rubyUnits takes the readings out of units, leaving each on the
+// first unit of its base along with the length of the base.
+func rubyUnits(units []unit) []unit {
+  res := units[:0]
+  esc := ""
+  base, reading := -1, (*strings.Builder)(nil)
+  for _, u := range units {
+    switch {
+      case u.first == rubyStart: {
+        esc += u.esc
+        base = len(res)
+        continue
+      }
+      case u.first == rubySep && base >= 0: {
+        esc += u.esc
+        reading = &strings.Builder{}
+        continue
+      }
+      case u.first == rubyEnd && reading != nil: {
+        esc += u.esc
+        if base < len(res) {
+          res[base].ruby = reading.String()
+          res[base].span = len(res) - base
+          for i := base + 1; i < len(res); i++ {res[i].glue = true}
+        }
+        base, reading = -1, nil
+        continue
+      }
+      case reading != nil: {
+        esc += u.esc
+        reading.WriteString(u.text)
+        continue
+      }
+    }
+    u.esc = esc + u.esc
+    esc = ""
+    res = append(res, u)
+  }
+  if esc != "" {res = append(res, unit{esc: esc})}
+  return res
+}
+
+// rubyLine places the readings of a line centred over their base
+// text, which starts at the columns cols. Readings pushed off
+// their base by the one before, or past limit, do not fit.
+func rubyLine(units []unit, cols []int, limit int) (string, bool) {
+  var res strings.Builder
+  col, fits := 0, true
+  for i, u := range units {
+    if u.ruby == "" {continue}
+    if i + u.span > len(units) {
+      fits = false
+      continue
+    }
+    width := 0
+    for _, v := range units[i:i + u.span] {width += v.width}
+
+    w := TextWidth(u.ruby)
+    at := cols[i] + (width - w) / 2
+    if at < 0 {at = 0}
+    if at < col {at = col}
+    if at >= cols[i] + width || at + w > limit {fits = false}
+    res.WriteString(strings.Repeat(" ", at - col))
+    res.WriteString(u.ruby)
+    col = at + w
+  }
+
+  if col == 0 {return "", fits}
+  if end := cols[len(cols) - 1]; end > col {
+    res.WriteString(strings.Repeat(" ", end - col))
+  }
+  return res.String(), fits
+}
@@ -0,0 +1,870 @@
+package render
+
+import (
+  "math"
+  "sort"
+  "image"
+  "regexp"
+  "strconv"
+  "strings"
+  "image/color"
+  "encoding/xml"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+// SVG is what is read from an SVG drawing: its text, to stand in
+// for it, and the picture it draws when it could be drawn.
+type SVG struct {
+  Title   string
+  Desc    string
+  Text  []string
+  Picture *Picture
+}
+
+// svgNode is an SVG element with its attributes, those set in
+// its style attribute included.
+type svgNode struct {
+  name     string
+  attrs    map[string]string
+  text     string
+  children []*svgNode
+}
+
+// ReadSVG consumes an <svg> element, resolving the images it
+// refers to from base.
+func ReadSVG(d *xml.Decoder, token xml.StartElement, files epub.Resources, base string) *SVG {
+  root := readSVGNode(d, token)
+  svg := &SVG{}
+  for _, c := range root.children {
+    switch c.name {
+      case "title": {svg.Title = c.content()}
+      case "desc": {svg.Desc = c.content()}
+    }
+  }
+  root.walk(func(n *svgNode) bool {
+    if n.name == "text" {
+      if s := n.content(); s != "" {svg.Text = append(svg.Text, s)}
+      return false
+    }
+    return n.name != "defs"
+  })
+
+  alt := svg.Title
+  if alt == "" {alt = "Image"}
+
+  // A drawing that only wraps an image, as covers often are,
+  // is shown as that image.
+  var images []*svgNode
+  shapes := 0
+  root.walk(func(n *svgNode) bool {
+    switch n.name {
+      case "image": {images = append(images, n)}
+      case "rect", "circle", "ellipse", "line", "polyline", "polygon", "path": {
+        shapes++
+      }
+    }
+    return n.name != "defs"
+  })
+  if len(images) == 1 && shapes == 0 {
+    link := images[0].attrs["href"]
+    if !strings.HasPrefix(link, "data:") {
+      svg.Picture = ReadPicture(files, epub.ResolveHref(base, link), alt)
+      if svg.Picture != nil {return svg}
+    }
+  }
+
+  if img := rasterize(root); img != nil {
+    svg.Picture = newPicture("", alt, img)
+    svg.Picture.Href = base + "#svg" + strconv.Itoa(svg.Picture.id)
+  }
+  return svg
+}
+
+// OpenSVG reads the SVG file at href, or returns nil.
+func OpenSVG(files epub.Resources, href string) *SVG {
+  reader, err := files.Open(href)
+  if err != nil {return nil}
+  defer reader.Close()
+
+  d := epub.NewDecoder(reader)
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    if token, ok := t.(xml.StartElement); ok && token.Name.Local == "svg" {
+      return ReadSVG(d, token, files, href)
+    }
+  }
+  return nil
+}
+
+// Caption is the text of the drawing, as its title, description
+// and the text set in it.
+func (this *SVG) Caption() string {
+  var parts []string
+  for _, s := range []string{this.Title, this.Desc, strings.Join(this.Text, " ")} {
+    if s != "" {parts = append(parts, s)}
+  }
+  return strings.Join(parts, " · ")
+}
+
+// putSVG places the picture of a drawing, if it has one, and its
+// text after it. Drawings without either fall back to the alt text.
+func (this *Document) putSVG(svg *SVG, link, alt string) {
+  caption := ""
+  if svg != nil {caption = svg.Caption()}
+  if caption == "" && svg != nil && svg.Title != "" {alt = svg.Title}
+  if svg == nil || svg.Picture == nil {
+    if caption != "" {alt = caption}
+    this.write(link + "\x1b[1;41m　" + alt + "　\x1b[22;40m")
+    return
+  }
+
+  this.putPicture(svg.Picture, link + "\x1b[1;41m　" + alt + "　\x1b[22;40m")
+  if caption == "" {return}
+  b := this.block()
+  if b == nil {b = &Block{}}
+  b.Align = "center"
+  this.blocks[this.Offset] = b
+  this.write("\x1b[2m" + caption + "\x1b[22m")
+  this.Offset++
+}
+
+func readSVGNode(d *xml.Decoder, token xml.StartElement) *svgNode {
+  node := &svgNode{name: token.Name.Local, attrs: map[string]string{}}
+  for _, a := range token.Attr {node.attrs[a.Name.Local] = a.Value}
+  for _, decl := range strings.Split(node.attrs["style"], ";") {
+    if k, v, ok := strings.Cut(decl, ":"); ok {
+      node.attrs[strings.TrimSpace(k)] = strings.TrimSpace(v)
+    }
+  }
+
+  for t, _ := d.Token(); t != nil; t, _ = d.Token() {
+    switch token := t.(type) {
+      case xml.CharData: {
+        node.children = append(node.children, &svgNode{text: string(token)})
+      }
+      case xml.StartElement: {
+        node.children = append(node.children, readSVGNode(d, token))
+      }
+      case xml.EndElement: {return node}
+    }
+  }
+  return node
+}
+
+// walk calls f on the node and its descendants, skipping the
+// children of nodes f returns false for.
+func (this *svgNode) walk(f func(*svgNode) bool) {
+  if this.name == "" || !f(this) {return}
+  for _, c := range this.children {c.walk(f)}
+}
+
+func (this *svgNode) content() string {
+  var res strings.Builder
+  var collect func(*svgNode)
+  collect = func(n *svgNode) {
+    if n.name == "" {res.WriteString(n.text + " ")}
+    for _, c := range n.children {collect(c)}
+  }
+  collect(this)
+  return strings.TrimSpace(collapseSpaces(res.String()))
+}
+
+func (this *svgNode) number(name string) float64 {
+  return svgLength(this.attrs[name])
+}
+
+// svgLength reads a length in pixels, or 0 for percentages and
+// what cannot be read.
+func svgLength(s string) float64 {
+  s = strings.TrimSpace(s)
+  units := map[string]float64{
+    "px": 1, "pt": 4.0 / 3, "pc": 16, "mm": 96 / 25.4, "cm": 96 / 2.54,
+    "in": 96, "em": 16, "ex": 8,
+  }
+  k := 1.0
+  for u, v := range units {
+    if strings.HasSuffix(s, u) {
+      s, k = strings.TrimSuffix(s, u), v
+      break
+    }
+  }
+  n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+  if err != nil {return 0}
+  return n * k
+}
+
+var svgNumberRe = regexp.MustCompile(
+  `[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?`,
+)
+
+func svgNumbers(s string) (res []float64) {
+  for _, m := range svgNumberRe.FindAllString(s, -1) {
+    n, _ := strconv.ParseFloat(m, 64)
+    res = append(res, n)
+  }
+  return
+}
+
+// affine maps x, y to a*x + c*y + e, b*x + d*y + f.
+type affine [6]float64
+
+var identity = affine{1, 0, 0, 1, 0, 0}
+
+func (m affine) mul(n affine) affine {
+  return affine{
+    m[0] * n[0] + m[2] * n[1],
+    m[1] * n[0] + m[3] * n[1],
+    m[0] * n[2] + m[2] * n[3],
+    m[1] * n[2] + m[3] * n[3],
+    m[0] * n[4] + m[2] * n[5] + m[4],
+    m[1] * n[4] + m[3] * n[5] + m[5],
+  }
+}
+
+func (m affine) apply(p [2]float64) [2]float64 {
+  return [2]float64{
+    m[0] * p[0] + m[2] * p[1] + m[4],
+    m[1] * p[0] + m[3] * p[1] + m[5],
+  }
+}
+
+// scale is how much lengths grow on average, as for stroke widths.
+func (m affine) scale() float64 {
+  return math.Sqrt(math.Abs(m[0] * m[3] - m[1] * m[2]))
+}
+
+var transformRe = regexp.MustCompile(
+  `(matrix|translate|scale|rotate|skewX|skewY)\s*\(([^)]*)\)`,
+)
+
+func parseTransform(s string) affine {
+  m := identity
+  for _, t := range transformRe.FindAllStringSubmatch(s, -1) {
+    n := svgNumbers(t[2])
+    arg := func(i int, def float64) float64 {
+      if i < len(n) {return n[i]}
+      return def
+    }
+    switch t[1] {
+      case "matrix": {
+        if len(n) == 6 {m = m.mul(affine{n[0], n[1], n[2], n[3], n[4], n[5]})}
+      }
+      case "translate": {m = m.mul(affine{1, 0, 0, 1, arg(0, 0), arg(1, 0)})}
+      case "scale": {
+        sx := arg(0, 1)
+        m = m.mul(affine{sx, 0, 0, arg(1, sx), 0, 0})
+      }
+      case "rotate": {
+        a := arg(0, 0) * math.Pi / 180
+        cx, cy := arg(1, 0), arg(2, 0)
+        m = m.mul(affine{1, 0, 0, 1, cx, cy})
+        m = m.mul(affine{math.Cos(a), math.Sin(a), -math.Sin(a), math.Cos(a), 0, 0})
+        m = m.mul(affine{1, 0, 0, 1, -cx, -cy})
+      }
+      case "skewX": {m = m.mul(affine{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0})}
+      case "skewY": {m = m.mul(affine{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0})}
+    }
+  }
+  return m
+}
+
+// svgStyle is the paint in effect for an element, as inherited.
+type svgStyle struct {
+  fill          string
+  stroke        string
+  width         float64
+  opacity       float64
+  fillOpacity   float64
+  strokeOpacity float64
+  evenOdd       bool
+}
+
+func (this svgStyle) inherit(n *svgNode) svgStyle {
+  a := n.attrs
+  if v, ok := a["fill"]; ok {this.fill = v}
+  if v, ok := a["stroke"]; ok {this.stroke = v}
+  if v, ok := a["stroke-width"]; ok {this.width = svgLength(v)}
+  if v, ok := a["fill-rule"]; ok {this.evenOdd = strings.TrimSpace(v) == "evenodd"}
+  number := func(name string, to *float64) {
+    if v, ok := a[name]; ok {
+      if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {*to = f}
+    }
+  }
+  opacity := 1.0
+  number("opacity", &opacity)
+  this.opacity *= opacity
+  number("fill-opacity", &this.fillOpacity)
+  number("stroke-opacity", &this.strokeOpacity)
+  return this
+}
+
+var svgColors = map[string]color.NRGBA{
+  "black": {0, 0, 0, 255}, "white": {255, 255, 255, 255},
+  "red": {255, 0, 0, 255}, "green": {0, 128, 0, 255},
+  "blue": {0, 0, 255, 255}, "yellow": {255, 255, 0, 255},
+  "cyan": {0, 255, 255, 255}, "aqua": {0, 255, 255, 255},
+  "magenta": {255, 0, 255, 255}, "fuchsia": {255, 0, 255, 255},
+  "gray": {128, 128, 128, 255}, "grey": {128, 128, 128, 255},
+  "silver": {192, 192, 192, 255}, "maroon": {128, 0, 0, 255},
+  "olive": {128, 128, 0, 255}, "lime": {0, 255, 0, 255},
+  "navy": {0, 0, 128, 255}, "purple": {128, 0, 128, 255},
+  "teal": {0, 128, 128, 255}, "orange": {255, 165, 0, 255},
+  "brown": {165, 42, 42, 255}, "pink": {255, 192, 203, 255},
+  "gold": {255, 215, 0, 255}, "darkgray": {169, 169, 169, 255},
+  "darkgrey": {169, 169, 169, 255}, "lightgray": {211, 211, 211, 255},
+  "lightgrey": {211, 211, 211, 255}, "dimgray": {105, 105, 105, 255},
+  "darkblue": {0, 0, 139, 255}, "darkred": {139, 0, 0, 255},
+  "darkgreen": {0, 100, 0, 255}, "lightblue": {173, 216, 230, 255},
+  "steelblue": {70, 130, 180, 255}, "skyblue": {135, 206, 235, 255},
+  "crimson": {220, 20, 60, 255}, "indigo": {75, 0, 130, 255},
+  "violet": {238, 130, 238, 255}, "beige": {245, 245, 220, 255},
+  "tan": {210, 180, 140, 255}, "khaki": {240, 230, 140, 255},
+  "salmon": {250, 128, 114, 255}, "coral": {255, 127, 80, 255},
+  "tomato": {255, 99, 71, 255}, "currentcolor": {0, 0, 0, 255},
+}
+
+var urlRe = regexp.MustCompile(`url\(\s*['"]?#([^'")]+)`)
+
+// svgColor reads a paint, with gradients and patterns taken as
+// their average colour.
+func svgColor(s string, paints map[string]color.NRGBA) (color.NRGBA, bool) {
+  s = strings.ToLower(strings.TrimSpace(s))
+  if m := urlRe.FindStringSubmatch(s); m != nil {
+    if c, ok := paints[m[1]]; ok {return c, true}
+    return color.NRGBA{128, 128, 128, 255}, true
+  }
+  if c, ok := svgColors[s]; ok {return c, true}
+
+  if strings.HasPrefix(s, "#") {
+    hex := s[1:]
+    if len(hex) == 3 || len(hex) == 4 {
+      hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+    }
+    if len(hex) >= 6 {
+      v, err := strconv.ParseUint(hex[:6], 16, 32)
+      if err == nil {return color.NRGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, true}
+    }
+  }
+  if strings.HasPrefix(s, "rgb") {
+    n := svgNumbers(s)
+    if len(n) >= 3 {
+      c := color.NRGBA{A: 255}
+      ch := []*uint8{&c.R, &c.G, &c.B}
+      percent := strings.Contains(s, "%")
+      for i, p := range ch {
+        v := n[i]
+        if percent {v = v * 255 / 100}
+        *p = uint8(math.Max(0, math.Min(255, v)))
+      }
+      return c, true
+    }
+  }
+  return color.NRGBA{}, false
+}
+
+// svgCanvas is the picture a drawing is rasterized into.
+type svgCanvas struct {
+  img    *image.NRGBA
+  ids    map[string]*svgNode
+  paints map[string]color.NRGBA
+  using  map[*svgNode]bool
+  budget int
+  drawn  bool
+}
+
+// rasterize draws the shapes of an SVG drawing, or returns nil
+// when there is nothing it could draw. Text is left out, as it is
+// read out instead, and so are images set among the shapes.
+func rasterize(root *svgNode) image.Image {
+  vb := svgNumbers(root.attrs["viewBox"])
+  w, h := root.number("width"), root.number("height")
+  if len(vb) == 4 && vb[2] > 0 && vb[3] > 0 {
+    switch {
+      case w <= 0 && h <= 0: {w, h = vb[2], vb[3]}
+      case w <= 0: {w = h * vb[2] / vb[3]}
+      case h <= 0: {h = w * vb[3] / vb[2]}
+    }
+  } else {
+    vb = nil
+    if w <= 0 {w = 300}
+    if h <= 0 {h = 150}
+  }
+
+  k := 1.0
+  if w > 800 {k = 800 / w}
+  if h * k > 1200 {k = 1200 / h}
+  width, height := int(w * k + 0.5), int(h * k + 0.5)
+  if width < 1 || height < 1 {return nil}
+
+  m := affine{k, 0, 0, k, 0, 0}
+  if vb != nil {
+    // The view box is fitted and centred, as by default.
+    s := math.Min(w / vb[2], h / vb[3])
+    tx := (w - vb[2] * s) / 2 - vb[0] * s
+    ty := (h - vb[3] * s) / 2 - vb[1] * s
+    m = m.mul(affine{s, 0, 0, s, tx, ty})
+  }
+
+  canvas := &svgCanvas{
+    img: image.NewNRGBA(image.Rect(0, 0, width, height)),
+    ids: map[string]*svgNode{},
+    paints: map[string]color.NRGBA{},
+    using: map[*svgNode]bool{},
+    budget: 10000,
+  }
+  root.walk(func(n *svgNode) bool {
+    if id := n.attrs["id"]; id != "" {canvas.ids[id] = n}
+    return true
+  })
+  for id, n := range canvas.ids {
+    if strings.HasSuffix(n.name, "Gradient") || n.name == "pattern" {
+      if c, ok := canvas.average(n); ok {canvas.paints[id] = c}
+    }
+  }
+
+  style := svgStyle{fill: "black", stroke: "none", width: 1,
+    opacity: 1, fillOpacity: 1, strokeOpacity: 1}
+  for _, c := range root.children {canvas.draw(c, m, style.inherit(root))}
+  if !canvas.drawn {return nil}
+  return canvas.img
+}
+
+// average is the mean colour of the stops of a gradient, or of
+// the fills in a pattern, following the href of those without
+// any but not round in circles.
+func (this *svgCanvas) average(n *svgNode) (color.NRGBA, bool) {
+  seen := map[*svgNode]bool{}
+  for n != nil && !seen[n] {
+    seen[n] = true
+    var r, g, b, count int
+    n.walk(func(c *svgNode) bool {
+      v, ok := c.attrs["stop-color"]
+      if !ok && c != n {v, ok = c.attrs["fill"]}
+      if ok {
+        if col, ok := svgColor(v, nil); ok {
+          r, g, b, count = r + int(col.R), g + int(col.G), b + int(col.B), count + 1
+        }
+      }
+      return true
+    })
+    if count > 0 {
+      return color.NRGBA{uint8(r / count), uint8(g / count), uint8(b / count), 255}, true
+    }
+    n = this.ids[strings.TrimPrefix(n.attrs["href"], "#")]
+  }
+  return color.NRGBA{}, false
+}
+
+func (this *svgCanvas) draw(n *svgNode, m affine, style svgStyle) {
+  if n.name == "" || this.using[n] || this.budget <= 0 {return}
+  this.budget--
+  if strings.TrimSpace(n.attrs["display"]) == "none" {return}
+  style = style.inherit(n)
+  m = m.mul(parseTransform(n.attrs["transform"]))
+
+  var paths [][][2]float64
+  var closed []bool
+  add := func(pts [][2]float64, close bool) {
+    paths = append(paths, pts)
+    closed = append(closed, close)
+  }
+
+  switch n.name {
+    case "g", "a", "switch", "svg": {
+      if n.name == "svg" {
+        m = m.mul(affine{1, 0, 0, 1, n.number("x"), n.number("y")})
+      }
+      for _, c := range n.children {this.draw(c, m, style)}
+      return
+    }
+    case "use": {
+      ref, ok := this.ids[strings.TrimPrefix(n.attrs["href"], "#")]
+      if !ok {return}
+      this.using[n] = true
+      this.draw(ref, m.mul(affine{1, 0, 0, 1, n.number("x"), n.number("y")}), style)
+      delete(this.using, n)
+      return
+    }
+    case "rect": {
+      x, y, w, h := n.number("x"), n.number("y"), n.number("width"), n.number("height")
+      if w <= 0 || h <= 0 {return}
+      add([][2]float64{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}, true)
+    }
+    case "circle", "ellipse": {
+      rx, ry := n.number("rx"), n.number("ry")
+      if n.name == "circle" {rx, ry = n.number("r"), n.number("r")}
+      if rx <= 0 || ry <= 0 {return}
+      cx, cy := n.number("cx"), n.number("cy")
+      var pts [][2]float64
+      for i := 0; i < 64; i++ {
+        a := float64(i) * math.Pi / 32
+        pts = append(pts, [2]float64{cx + rx * math.Cos(a), cy + ry * math.Sin(a)})
+      }
+      add(pts, true)
+    }
+    case "line": {
+      add([][2]float64{
+        {n.number("x1"), n.number("y1")}, {n.number("x2"), n.number("y2")},
+      }, false)
+    }
+    case "polyline", "polygon": {
+      nums := svgNumbers(n.attrs["points"])
+      var pts [][2]float64
+      for i := 0; i + 1 < len(nums); i += 2 {
+        pts = append(pts, [2]float64{nums[i], nums[i + 1]})
+      }
+      add(pts, n.name == "polygon")
+    }
+    case "path": {paths, closed = parsePath(n.attrs["d"])}
+    default: {return}
+  }
+
+  for _, pts := range paths {
+    for i := range pts {pts[i] = m.apply(pts[i])}
+  }
+  if c, ok := svgColor(style.fill, this.paints); ok && n.name != "line" {
+    this.fill(paths, style.evenOdd, c, style.opacity * style.fillOpacity)
+  }
+  if c, ok := svgColor(style.stroke, this.paints); ok && style.width > 0 {
+    width := math.Max(style.width * m.scale(), 0.75)
+    this.fill(strokes(paths, closed, width), false, c, style.opacity * style.strokeOpacity)
+  }
+}
+
+// fill paints the area inside the polygons, by the nonzero or
+// the even-odd rule, with four rows of samples to a pixel and
+// the exact coverage along each row.
+func (this *svgCanvas) fill(paths [][][2]float64, evenOdd bool, c color.NRGBA, alpha float64) {
+  type edge struct {
+    x0, y0, x1, y1 float64
+    dir int
+  }
+  var edges []edge
+  minY, maxY := math.Inf(1), math.Inf(-1)
+  for _, pts := range paths {
+    for i := range pts {
+      p, q := pts[i], pts[(i + 1) % len(pts)]
+      minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+      if p[1] == q[1] {continue}
+      if p[1] < q[1] {
+        edges = append(edges, edge{p[0], p[1], q[0], q[1], 1})
+      } else {
+        edges = append(edges, edge{q[0], q[1], p[0], p[1], -1})
+      }
+    }
+  }
+  if len(edges) == 0 || alpha <= 0 {return}
+
+  b := this.img.Bounds()
+  const samples = 4
+  cover := make([]float64, b.Dx() + 1)
+  type cross struct {
+    x   float64
+    dir int
+  }
+  for py := int(math.Max(0, math.Floor(minY))); py < b.Max.Y && float64(py) <= maxY; py++ {
+    for i := range cover {cover[i] = 0}
+    for s := 0; s < samples; s++ {
+      y := float64(py) + (float64(s) + 0.5) / samples
+      var xs []cross
+      for _, e := range edges {
+        if y < e.y0 || y >= e.y1 {continue}
+        x := e.x0 + (y - e.y0) * (e.x1 - e.x0) / (e.y1 - e.y0)
+        xs = append(xs, cross{x, e.dir})
+      }
+      sort.Slice(xs, func(i, j int) bool {return xs[i].x < xs[j].x})
+
+      winding := 0
+      for i, x := range xs {
+        winding += x.dir
+        inside := winding != 0
+        if evenOdd {inside = (i + 1) % 2 == 1}
+        if !inside || i + 1 >= len(xs) {continue}
+        span(cover, x.x, xs[i + 1].x, 1.0 / samples)
+      }
+    }
+    for px, v := range cover[:b.Dx()] {
+      if v > 0 {this.blend(px, py, c, math.Min(v, 1) * alpha)}
+    }
+  }
+  this.drawn = true
+}
+
+// span adds the part of each pixel between x0 and x1 to cover.
+func span(cover []float64, x0, x1, weight float64) {
+  x0 = math.Max(x0, 0)
+  x1 = math.Min(x1, float64(len(cover) - 1))
+  for x0 < x1 {
+    px := math.Floor(x0)
+    end := math.Min(px + 1, x1)
+    cover[int(px)] += (end - x0) * weight
+    x0 = end
+  }
+}
+
+func (this *svgCanvas) blend(x, y int, c color.NRGBA, alpha float64) {
+  if !(image.Point{x, y}).In(this.img.Rect) {return}
+  alpha *= float64(c.A) / 255
+  if alpha <= 0 {return}
+  d := this.img.NRGBAAt(x, y)
+  da := float64(d.A) / 255
+  a := alpha + da * (1 - alpha)
+  mix := func(s, t uint8) uint8 {
+    return uint8((float64(s) * alpha + float64(t) * da * (1 - alpha)) / a + 0.5)
+  }
+  this.img.SetNRGBA(x, y, color.NRGBA{
+    mix(c.R, d.R), mix(c.G, d.G), mix(c.B, d.B), uint8(a * 255 + 0.5),
+  })
+}
+
+// strokes outlines the lines of the paths as polygons of the given
+// width with round joins, all wound the same way so that nonzero
+// filling joins them.
+func strokes(paths [][][2]float64, closed []bool, width float64) (res [][][2]float64) {
+  r := width / 2
+  oriented := func(pts [][2]float64) [][2]float64 {
+    area := 0.0
+    for i := range pts {
+      p, q := pts[i], pts[(i + 1) % len(pts)]
+      area += p[0] * q[1] - q[0] * p[1]
+    }
+    if area < 0 {
+      for i, j := 0, len(pts) - 1; i < j; i, j = i + 1, j - 1 {
+        pts[i], pts[j] = pts[j], pts[i]
+      }
+    }
+    return pts
+  }
+  for k, pts := range paths {
+    n := len(pts)
+    if closed[k] && n > 2 {pts = append(pts, pts[0])}
+    for i := 0; i + 1 < len(pts); i++ {
+      p, q := pts[i], pts[i + 1]
+      dx, dy := q[0] - p[0], q[1] - p[1]
+      l := math.Hypot(dx, dy)
+      if l == 0 {continue}
+      nx, ny := -dy / l * r, dx / l * r
+      res = append(res, oriented([][2]float64{
+        {p[0] + nx, p[1] + ny}, {q[0] + nx, q[1] + ny},
+        {q[0] - nx, q[1] - ny}, {p[0] - nx, p[1] - ny},
+      }))
+    }
+    if r < 1 {continue}
+    for _, p := range pts {
+      var dot [][2]float64
+      for i := 0; i < 12; i++ {
+        a := float64(i) * math.Pi / 6
+        dot = append(dot, [2]float64{p[0] + r * math.Cos(a), p[1] + r * math.Sin(a)})
+      }
+      res = append(res, dot)
+    }
+  }
+  return
+}
+
+// pathScanner reads the numbers and flags of path data.
+type pathScanner struct {
+  s string
+  i int
+}
+
+func (this *pathScanner) skip() {
+  for this.i < len(this.s) && strings.IndexByte(" \t\r\n,", this.s[this.i]) >= 0 {
+    this.i++
+  }
+}
+
+func (this *pathScanner) number() (float64, bool) {
+  this.skip()
+  loc := svgNumberRe.FindStringIndex(this.s[this.i:])
+  if loc == nil || loc[0] != 0 {return 0, false}
+  n, err := strconv.ParseFloat(this.s[this.i:this.i + loc[1]], 64)
+  this.i += loc[1]
+  return n, err == nil
+}
+
+func (this *pathScanner) flag() (bool, bool) {
+  this.skip()
+  if this.i >= len(this.s) || (this.s[this.i] != '0' && this.s[this.i] != '1') {
+    return false, false
+  }
+  this.i++
+  return this.s[this.i - 1] == '1', true
+}
+
+func (this *pathScanner) numbers(n int) ([]float64, bool) {
+  res := make([]float64, n)
+  for i := range res {
+    v, ok := this.number()
+    if !ok {return nil, false}
+    res[i] = v
+  }
+  return res, true
+}
+
+// parsePath turns path data into polylines, flattening curves
+// and arcs, and tells which of them are closed.
+func parsePath(d string) (paths [][][2]float64, closed []bool) {
+  sc := &pathScanner{s: d}
+  var cur [][2]float64
+  var x, y, sx, sy, cx, cy float64
+  var cmd, last byte
+
+  end := func(close bool) {
+    if len(cur) > 1 {
+      paths = append(paths, cur)
+      closed = append(closed, close)
+    }
+    cur = nil
+  }
+  to := func(nx, ny float64) {
+    if cur == nil {cur = [][2]float64{{x, y}}}
+    cur = append(cur, [2]float64{nx, ny})
+    x, y = nx, ny
+  }
+  cubic := func(x1, y1, x2, y2, x3, y3 float64) {
+    x0, y0 := x, y
+    for i := 1; i <= 16; i++ {
+      t := float64(i) / 16
+      u := 1 - t
+      to(u * u * u * x0 + 3 * u * u * t * x1 + 3 * u * t * t * x2 + t * t * t * x3,
+        u * u * u * y0 + 3 * u * u * t * y1 + 3 * u * t * t * y2 + t * t * t * y3)
+    }
+    cx, cy = x2, y2
+  }
+  quad := func(x1, y1, x2, y2 float64) {
+    x0, y0 := x, y
+    for i := 1; i <= 12; i++ {
+      t := float64(i) / 12
+      u := 1 - t
+      to(u * u * x0 + 2 * u * t * x1 + t * t * x2, u * u * y0 + 2 * u * t * y1 + t * t * y2)
+    }
+    cx, cy = x1, y1
+  }
+
+  for {
+    sc.skip()
+    if sc.i >= len(sc.s) {break}
+    if c := sc.s[sc.i]; (c | 0x20) >= 'a' && (c | 0x20) <= 'z' {
+      cmd = c
+      sc.i++
+    } else if cmd == 0 || cmd == 'Z' || cmd == 'z' {
+      break
+    }
+
+    rel := cmd >= 'a'
+    ox, oy := 0.0, 0.0
+    if rel {ox, oy = x, y}
+    upper := cmd &^ 0x20
+    switch upper {
+      case 'Z': {
+        end(true)
+        x, y = sx, sy
+      }
+      case 'M': {
+        n, ok := sc.numbers(2)
+        if !ok {return}
+        end(false)
+        x, y = n[0] + ox, n[1] + oy
+        sx, sy = x, y
+        cmd = 'L' | (cmd & 0x20)
+      }
+      case 'L': {
+        n, ok := sc.numbers(2)
+        if !ok {return}
+        to(n[0] + ox, n[1] + oy)
+      }
+      case 'H': {
+        n, ok := sc.number()
+        if !ok {return}
+        to(n + ox, y)
+      }
+      case 'V': {
+        n, ok := sc.number()
+        if !ok {return}
+        to(x, n + oy)
+      }
+      case 'C': {
+        n, ok := sc.numbers(6)
+        if !ok {return}
+        cubic(n[0] + ox, n[1] + oy, n[2] + ox, n[3] + oy, n[4] + ox, n[5] + oy)
+      }
+      case 'S': {
+        n, ok := sc.numbers(4)
+        if !ok {return}
+        x1, y1 := x, y
+        if last == 'C' || last == 'S' {x1, y1 = 2 * x - cx, 2 * y - cy}
+        cubic(x1, y1, n[0] + ox, n[1] + oy, n[2] + ox, n[3] + oy)
+      }
+      case 'Q': {
+        n, ok := sc.numbers(4)
+        if !ok {return}
+        quad(n[0] + ox, n[1] + oy, n[2] + ox, n[3] + oy)
+      }
+      case 'T': {
+        n, ok := sc.numbers(2)
+        if !ok {return}
+        x1, y1 := x, y
+        if last == 'Q' || last == 'T' {x1, y1 = 2 * x - cx, 2 * y - cy}
+        quad(x1, y1, n[0] + ox, n[1] + oy)
+      }
+      case 'A': {
+        n, ok := sc.numbers(3)
+        if !ok {return}
+        large, ok1 := sc.flag()
+        sweep, ok2 := sc.flag()
+        p, ok3 := sc.numbers(2)
+        if !ok1 || !ok2 || !ok3 {return}
+        for _, pt := range arcPoints(x, y, n[0], n[1], n[2], large, sweep, p[0] + ox, p[1] + oy) {
+          to(pt[0], pt[1])
+        }
+      }
+      default: {return}
+    }
+    last = upper
+  }
+  end(false)
+  return
+}
+
+// arcPoints flattens an elliptical arc from x0, y0 to x1, y1, as
+// set out in the SVG implementation notes.
+func arcPoints(x0, y0, rx, ry, rot float64, large, sweep bool, x1, y1 float64) [][2]float64 {
+  rx, ry = math.Abs(rx), math.Abs(ry)
+  if rx == 0 || ry == 0 || (x0 == x1 && y0 == y1) {return [][2]float64{{x1, y1}}}
+
+  phi := rot * math.Pi / 180
+  cos, sin := math.Cos(phi), math.Sin(phi)
+  dx, dy := (x0 - x1) / 2, (y0 - y1) / 2
+  px, py := cos * dx + sin * dy, -sin * dx + cos * dy
+
+  if l := px * px / (rx * rx) + py * py / (ry * ry); l > 1 {
+    rx, ry = rx * math.Sqrt(l), ry * math.Sqrt(l)
+  }
+  num := rx * rx * ry * ry - rx * rx * py * py - ry * ry * px * px
+  den := rx * rx * py * py + ry * ry * px * px
+  k := math.Sqrt(math.Max(0, num / den))
+  if large == sweep {k = -k}
+  cxp, cyp := k * rx * py / ry, -k * ry * px / rx
+  cx := cos * cxp - sin * cyp + (x0 + x1) / 2
+  cy := sin * cxp + cos * cyp + (y0 + y1) / 2
+
+  angle := func(ux, uy, vx, vy float64) float64 {
+    return math.Atan2(ux * vy - uy * vx, ux * vx + uy * vy)
+  }
+  t0 := angle(1, 0, (px - cxp) / rx, (py - cyp) / ry)
+  dt := angle((px - cxp) / rx, (py - cyp) / ry, (-px - cxp) / rx, (-py - cyp) / ry)
+  if !sweep && dt > 0 {dt -= 2 * math.Pi}
+  if sweep && dt < 0 {dt += 2 * math.Pi}
+
+  steps := int(math.Ceil(math.Abs(dt) / (math.Pi / 16)))
+  if steps < 1 {steps = 1}
+  res := make([][2]float64, 0, steps)
+  for i := 1; i <= steps; i++ {
+    t := t0 + dt * float64(i) / float64(steps)
+    ex, ey := rx * math.Cos(t), ry * math.Sin(t)
+    res = append(res, [2]float64{cos * ex - sin * ey + cx, sin * ex + cos * ey + cy})
+  }
+  res[len(res) - 1] = [2]float64{x1, y1}
+  return res
+}
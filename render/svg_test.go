@@ -0,0 +1,47 @@
+package render
+
+import (
+  "strings"
+  "testing"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+func TestSVGReferenceCycles(t *testing.T) {
+  tests := []string{
+    `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+      <defs>
+        <linearGradient id="a" xlink:href="#b"/>
+        <linearGradient id="b" xlink:href="#a"/>
+      </defs>
+      <rect width="10" height="10" fill="url(#a)"/>
+    </svg>`,
+    `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+      <g id="g"><rect width="10" height="10"/><use xlink:href="#g"/></g>
+    </svg>`,
+    `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+      <g id="a"><use xlink:href="#b"/><use xlink:href="#b"/><use xlink:href="#b"/></g>
+      <g id="b"><use xlink:href="#c"/><use xlink:href="#c"/><use xlink:href="#c"/></g>
+      <g id="c"><use xlink:href="#a"/><use xlink:href="#a"/><rect width="1" height="1"/></g>
+    </svg>`,
+  }
+  for i, src := range tests {
+    svg := OpenSVG(epub.Memory{"a.svg": []byte(src)}, "a.svg")
+    if svg == nil || svg.Picture == nil {
+      t.Errorf("%d: drawing not rasterized", i)
+    }
+  }
+}
+
+func TestSVGCaption(t *testing.T) {
+  src := `<svg xmlns="http://www.w3.org/2000/svg">
+    <title>Map</title><desc>The coast</desc>
+    <text x="1" y="1">North</text><text x="1" y="9">South</text>
+  </svg>`
+  svg := OpenSVG(epub.Memory{"a.svg": []byte(src)}, "a.svg")
+  if svg == nil {t.Fatal("no drawing")}
+  if got, want := svg.Caption(), "Map · The coast · North South"; got != want {
+    t.Errorf("caption %q, want %q", got, want)
+  }
+  if !strings.Contains(svg.Desc, "coast") {t.Errorf("desc %q", svg.Desc)}
+}
@@ -0,0 +1,417 @@
+package render
+
+import (
+  "strconv"
+  "strings"
+  "encoding/xml"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+type tableCell struct {
+  Text    []string
+  Header  bool
+  Row     int
+  Col     int
+  Rowspan int
+  Colspan int
+}
+
+type Table struct {
+  Caption string
+  Cells   []*tableCell
+  Rows    int
+  Cols    int
+  Headers int  // number of leading header rows
+
+  grid  [][]*tableCell
+}
+
+// boxChars maps lines going up, down, left and right from a
+// crossing to the box-drawing character joining them.
+var boxChars = map[[4]bool]string{
+  {true, true, true, true}: "┼",
+  {true, true, false, true}: "├",
+  {true, true, true, false}: "┤",
+  {false, true, true, true}: "┬",
+  {true, false, true, true}: "┴",
+  {false, true, false, true}: "┌",
+  {false, true, true, false}: "┐",
+  {true, false, false, true}: "└",
+  {true, false, true, false}: "┘",
+  {true, true, false, false}: "│",
+  {false, false, true, true}: "─",
+}
+
+var boxDouble = map[string]string{
+  "┼": "╪", "├": "╞", "┤": "╡", "┬": "╤", "┴": "╧",
+  "┌": "╒", "┐": "╕", "└": "╘", "┘": "╛", "─": "═",
+}
+
+// ReadTable consumes the table the decoder has just entered.
+func ReadTable(d *xml.Decoder) *Table {
+  t := &Table{}
+  var cell *tableCell
+  var text string
+  row := -1
+  inHead := false
+
+  for tok, _ := d.Token(); tok != nil; tok, _ = d.Token() {
+    switch token := tok.(type) {
+      case xml.CharData: {
+        if cell != nil {text += string(token)}
+      }
+
+      case xml.StartElement: {
+        switch token.Name.Local {
+          case "caption": {t.Caption = epub.InnerText(d)}
+          case "thead": {inHead = true}
+          case "tr": {row++}
+          case "td", "th": {
+            if row < 0 {row = 0}
+            cell = &tableCell{
+              Header: token.Name.Local == "th" || inHead,
+              Row: row,
+              Rowspan: spanAttr(token, "rowspan"),
+              Colspan: spanAttr(token, "colspan"),
+            }
+            text = ""
+          }
+          case "table": {
+            nested := epub.InnerText(d)
+            if cell != nil {text += " " + nested}
+          }
+          case "br", "p", "div", "li": {text += "\n"}
+          case "b", "strong": {text += "\x1b[1m"}
+          case "i", "em": {text += "\x1b[3m"}
+          case "sup": {text += convertSUP(d)}
+          case "sub": {text += convertSUB(d)}
+        }
+      }
+
+      case xml.EndElement: {
+        switch token.Name.Local {
+          case "table": {
+            t.build()
+            return t
+          }
+          case "thead": {inHead = false}
+          case "td", "th": {
+            if cell != nil {
+              cell.Text = cellLines(text)
+              t.Cells = append(t.Cells, cell)
+            }
+            cell = nil
+          }
+          case "b", "strong": {text += "\x1b[22m"}
+          case "i", "em": {text += "\x1b[23m"}
+        }
+      }
+    }
+  }
+
+  t.build()
+  return t
+}
+
+func spanAttr(token xml.StartElement, name string) int {
+  n, err := strconv.Atoi(epub.AttrValue(token, name))
+  if err != nil || n < 1 {return 1}
+  if n > 1000 {return 1000}
+  return n
+}
+
+func cellLines(text string) (lines []string) {
+  for _, v := range strings.Split(text, "\n") {
+    v = strings.Join(strings.Fields(v), " ")
+    if v != "" {lines = append(lines, v)}
+  }
+  return
+}
+
+func (this *Table) rowIsHeader(row int) bool {
+  found := false
+  for _, c := range this.Cells {
+    if c.Row != row {continue}
+    if !c.Header {return false}
+    found = true
+  }
+  return found
+}
+
+// build places the cells on a grid, moving them right of the
+// slots taken by row spans from above.
+func (this *Table) build() {
+  this.grid = nil
+  this.Rows = 0
+  this.Cols = 0
+  taken := func(r, c int) bool {
+    return r < len(this.grid) && c < len(this.grid[r]) && this.grid[r][c] != nil
+  }
+
+  col := 0
+  last := -1
+  for _, cell := range this.Cells {
+    if cell.Row != last {
+      col = 0
+      last = cell.Row
+    }
+    for taken(cell.Row, col) {col++}
+    cell.Col = col
+
+    for r := cell.Row; r < cell.Row + cell.Rowspan; r++ {
+      for len(this.grid) <= r {this.grid = append(this.grid, nil)}
+      for c := col; c < col + cell.Colspan; c++ {
+        for len(this.grid[r]) <= c {
+          this.grid[r] = append(this.grid[r], nil)
+        }
+        this.grid[r][c] = cell
+      }
+    }
+    col += cell.Colspan
+    if col > this.Cols {this.Cols = col}
+  }
+
+  this.Rows = last + 1
+  if len(this.grid) > this.Rows {this.grid = this.grid[:this.Rows]}
+  this.Headers = 0
+  for this.Headers < this.Rows && this.rowIsHeader(this.Headers) {
+    this.Headers++
+  }
+  for r := range this.grid {
+    for len(this.grid[r]) < this.Cols {
+      this.grid[r] = append(this.grid[r], nil)
+    }
+  }
+}
+
+func (this *Table) at(r, c int) *tableCell {
+  if r < 0 || r >= len(this.grid) || c < 0 || c >= this.Cols {return nil}
+  return this.grid[r][c]
+}
+
+func cellWidth(cell *tableCell) (natural, min int) {
+  for _, line := range cell.Text {
+    if w := TextWidth(line); w > natural {natural = w}
+    for _, word := range strings.Split(line, " ") {
+      if w := TextWidth(word); w > min {min = w}
+    }
+  }
+  return
+}
+
+// widths picks the column widths for the table to fit in width,
+// returning nil when even the narrowest layout does not fit.
+func (this *Table) widths(width int) []int {
+  n := this.Cols
+  natural := make([]int, n)
+  min := make([]int, n)
+
+  for span := 1; span <= n; span++ {
+    for _, cell := range this.Cells {
+      if cell.Colspan != span {continue}
+      nat, mn := cellWidth(cell)
+      cols := []int{cell.Col, cell.Col + span}
+      grow(natural, cols, nat)
+      grow(min, cols, mn)
+    }
+  }
+  for i := range natural {
+    if natural[i] < min[i] {natural[i] = min[i]}
+  }
+
+  avail := width - 3 * n - 1
+  if sum(natural) <= avail {return natural}
+  if sum(min) > avail {return nil}
+
+  w := append([]int{}, min...)
+  extra := avail - sum(min)
+  want := sum(natural) - sum(min)
+  given := 0
+  for i := range w {
+    add := (natural[i] - min[i]) * extra / want
+    w[i] += add
+    given += add
+  }
+  for i := 0; given < extra; i = (i + 1) % n {
+    if w[i] < natural[i] {
+      w[i]++
+      given++
+    }
+  }
+  return w
+}
+
+// grow widens the columns from cols[0] to cols[1] so that
+// together with their separators they hold size columns.
+func grow(w []int, cols []int, size int) {
+  have := 3 * (cols[1] - cols[0] - 1)
+  for i := cols[0]; i < cols[1]; i++ {have += w[i]}
+  for i := cols[0]; have < size; i++ {
+    if i == cols[1] {i = cols[0]}
+    w[i]++
+    have++
+  }
+}
+
+func sum(a []int) (s int) {
+  for _, v := range a {s += v}
+  return
+}
+
+func pad(s string, w int) string {
+  if n := w - TextWidth(s); n > 0 {s += strings.Repeat(" ", n)}
+  return s
+}
+
+// Render lays the table out for the given width, falling back to
+// one record per row when the columns cannot fit.
+func (this *Table) Render(width int) (lines []string) {
+  if width < 1 {width = 1}
+  if this.Caption != "" {
+    for _, v := range WordWrap(this.Caption, width) {
+      lines = append(lines, "\x1b[1m" + v + "\x1b[22m")
+    }
+  }
+  if this.Cols == 0 {return}
+
+  w := this.widths(width)
+  if w == nil {return append(lines, this.records(width)...)}
+
+  span := func(cell *tableCell) int {
+    s := 3 * (cell.Colspan - 1)
+    for i := cell.Col; i < cell.Col + cell.Colspan; i++ {s += w[i]}
+    return s
+  }
+
+  wrapped := map[*tableCell][]string{}
+  for _, cell := range this.Cells {
+    for _, v := range cell.Text {
+      for _, l := range WordWrap(v, span(cell)) {
+        if cell.Header {l = "\x1b[1m" + l + "\x1b[22m"}
+        wrapped[cell] = append(wrapped[cell], l)
+      }
+    }
+  }
+
+  // Heights of the rows, then of the rows closing a row span
+  // grown to fit the spanning cell.
+  heights := make([]int, this.Rows)
+  for _, cell := range this.Cells {
+    if cell.Rowspan == 1 && len(wrapped[cell]) > heights[cell.Row] {
+      heights[cell.Row] = len(wrapped[cell])
+    }
+  }
+  for r := range heights {
+    if heights[r] == 0 {heights[r] = 1}
+  }
+  for _, cell := range this.Cells {
+    end := cell.Row + cell.Rowspan - 1
+    if cell.Rowspan == 1 || end >= this.Rows {continue}
+    have := cell.Rowspan - 1
+    for r := cell.Row; r <= end; r++ {have += heights[r]}
+    if need := len(wrapped[cell]) - have; need > 0 {heights[end] += need}
+  }
+
+  starts := make([]int, this.Rows)
+  y := 0
+  for r := range heights {
+    starts[r] = y
+    y += heights[r] + 1
+  }
+
+  text := func(cell *tableCell, y int) string {
+    i := y - starts[cell.Row]
+    if i < 0 || i >= len(wrapped[cell]) {return ""}
+    return wrapped[cell][i]
+  }
+
+  // border draws the line between row r and r + 1, filling the
+  // columns of cells spanning over it with their text.
+  border := func(r int, y int) string {
+    str := ""
+    double := r >= 0 && r + 1 == this.Headers && r + 1 < this.Rows
+    for c := 0; c <= this.Cols; c++ {
+      up := c == 0 || c == this.Cols ||
+        this.at(r, c - 1) != this.at(r, c)
+      down := c == 0 || c == this.Cols ||
+        this.at(r + 1, c - 1) != this.at(r + 1, c)
+      if r < 0 {up = false}
+      if r + 1 >= this.Rows {down = false}
+
+      cross := func(c int) bool {
+        if c < 0 || c >= this.Cols {return false}
+        cell := this.at(r, c)
+        return cell == nil || cell != this.at(r + 1, c)
+      }
+      left, right := cross(c - 1), cross(c)
+      if r < 0 || r + 1 >= this.Rows {
+        left, right = c > 0, c < this.Cols
+      }
+
+      ch, ok := boxChars[[4]bool{up, down, left, right}]
+      if !ok {ch = " "}
+      if double {
+        if v, ok := boxDouble[ch]; ok {ch = v}
+      }
+      str += ch
+      if c == this.Cols {break}
+
+      if right {
+        line := "─"
+        if double {line = "═"}
+        str += strings.Repeat(line, w[c] + 2)
+        continue
+      }
+      cell := this.at(r, c)
+      str += " " + pad(text(cell, y), span(cell)) + " "
+      c = cell.Col + cell.Colspan - 1
+    }
+    return str
+  }
+
+  lines = append(lines, border(-1, -1))
+  for r := 0; r < this.Rows; r++ {
+    for i := 0; i < heights[r]; i++ {
+      y := starts[r] + i
+      str := ""
+      for c := 0; c < this.Cols; {
+        cell := this.at(r, c)
+        if cell == nil {
+          str += "│ " + strings.Repeat(" ", w[c]) + " "
+          c++
+          continue
+        }
+        str += "│ " + pad(text(cell, y), span(cell)) + " "
+        c = cell.Col + cell.Colspan
+      }
+      lines = append(lines, str + "│")
+    }
+    lines = append(lines, border(r, starts[r] + heights[r]))
+  }
+  return
+}
+
+// records prints every row as a list of "header: value" lines.
+func (this *Table) records(width int) (lines []string) {
+  names := make([]string, this.Cols)
+  for _, cell := range this.Cells {
+    if cell.Row < this.Headers && cell.Col < this.Cols {
+      names[cell.Col] = strings.Join(cell.Text, " ")
+    }
+  }
+
+  rule := strings.Repeat("─", width)
+  for r := this.Headers; r < this.Rows; r++ {
+    lines = append(lines, rule)
+    for _, cell := range this.Cells {
+      if cell.Row != r {continue}
+      text := strings.Join(cell.Text, " ")
+      if name := names[cell.Col]; name != "" {
+        text = "\x1b[1m" + name + ":\x1b[22m " + text
+      }
+      lines = append(lines, WordWrap(text, width)...)
+    }
+  }
+  return append(lines, rule)
+}
@@ -0,0 +1,68 @@
+package render
+
+import (
+  "strings"
+  "testing"
+
+  "github.com/MD-IS/levt/epub"
+)
+
+func readTable(t *testing.T, src string) *Table {
+  d := epub.NewDecoder(strings.NewReader(src))
+  d.Token()
+  return ReadTable(d)
+}
+
+const testTable = `<table>
+  <caption>Tides</caption>
+  <tr><th>Port</th><th>High water</th><th>Low water</th></tr>
+  <tr><td>Brest</td><td>06:12</td><td>12:30</td></tr>
+  <tr><td colspan="2">Saint-Malo and the Channel Islands</td><td>13:05</td></tr>
+</table>`
+
+func TestTableRender(t *testing.T) {
+  table := readTable(t, testTable)
+  for _, width := range []int{80, 30, 12, 1, 0, -5} {
+    lines := table.Render(width)
+    if len(lines) == 0 {t.Errorf("width %d: nothing drawn", width)}
+    limit := width
+    if limit < 1 {limit = 1}
+    for _, v := range lines {
+      if TextWidth(v) > limit {
+        t.Errorf("width %d: %q is %d wide", width, v, TextWidth(v))
+      }
+    }
+  }
+}
+
+func TestTableGrid(t *testing.T) {
+  lines := readTable(t, testTable).Render(80)
+  want := []string{
+    "\x1b[1mTides\x1b[22m",
+    "┌───────────────┬────────────────────┬───────────┐",
+  }
+  for i, v := range want {
+    if i >= len(lines) || lines[i] != v {
+      t.Fatalf("line %d: %q, want %q", i, lines[i], v)
+    }
+  }
+  if !strings.HasPrefix(lines[3], "╞") {t.Errorf("header rule %q", lines[3])}
+}
+
+func TestTableRecords(t *testing.T) {
+  lines := readTable(t, testTable).Render(24)
+  text := strings.Join(lines, "\n")
+  if !strings.Contains(text, "\x1b[1mPort:\x1b[22m Brest") {
+    t.Errorf("no record for Brest in\n%s", text)
+  }
+}
+
+func TestLayoutNarrow(t *testing.T) {
+  table := readTable(t, testTable)
+  b := &Block{Margin: strings.Repeat(" ", 12), Render: table.Render}
+  for _, width := range []int{10, 4, 1} {
+    for _, vertical := range []bool{false, true} {
+      b.Layout("", Wrap{Width: width, Vertical: vertical})
+    }
+  }
+}
@@ -0,0 +1,57 @@
+package render
+
+import "strings"
+
+// Forms taken by punctuation set in vertical text, as the
+// CJK vertical presentation forms or their nearest fit.
+var verticalForms = map[rune]rune{
+  '、': '︑', '。': '︒', '，': '︐', '．': '︒', '：': '︓', '；': '︔',
+  '！': '︕', '？': '︖', '「': '﹁', '」': '﹂', '『': '﹃', '』': '﹄',
+  '（': '︵', '）': '︶', '｛': '︷', '｝': '︸', '〔': '︹', '〕': '︺',
+  '【': '︻', '】': '︼', '《': '︽', '》': '︾', '〈': '︿', '〉': '﹀',
+  '［': '﹇', '］': '﹈', '〖': '︗', '〗': '︘', '…': '︙', '‥': '︰',
+  '―': '︱', '—': '︱', '–': '︲', 'ー': '｜', '－': '｜', '〜': '≀',
+  '～': '≀', '＿': '︳', '“': '〝', '”': '〟',
+}
+
+// FullWidth turns the printable ASCII of s into its full width
+// forms, so that Latin letters and digits stand upright in a
+// vertical line. Escape sequences are left as they are.
+func FullWidth(s string) string {
+  var res strings.Builder
+  for s != "" {
+    text := s
+    loc := sgrRe.FindStringIndex(s)
+    if loc != nil {text = s[:loc[0]]}
+    for _, r := range text {
+      switch {
+        case r == ' ': {res.WriteRune('　')}
+        case r > ' ' && r < 0x7F: {res.WriteRune(r + 0xFEE0)}
+        default: {res.WriteRune(r)}
+      }
+    }
+    if loc == nil {break}
+    res.WriteString(s[loc[0]:loc[1]])
+    s = s[loc[1]:]
+  }
+  return res.String()
+}
+
+// Cells splits a vertical line into the two column wide cells it
+// takes from top to bottom, each carrying its own style.
+func Cells(line string) (res []string) {
+  state := ""
+  for _, u := range splitUnits(line) {
+    state = activeSGR(state + u.esc)
+    if u.text == "" {continue}
+
+    text := u.text
+    if r, ok := verticalForms[u.first]; ok {text = string(r)}
+    if pad := 2 - TextWidth(text); pad > 0 {
+      text += strings.Repeat(" ", pad)
+    }
+    if state != "" {text = state + text + "\x1b[m"}
+    res = append(res, text)
+  }
+  return
+}
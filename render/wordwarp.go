@@ -0,0 +1,402 @@
+package render
+
+import "regexp"
+import "strings"
+import "sort"
+import "unicode"
+import "github.com/rivo/uniseg"
+import "github.com/mattn/go-runewidth"
+
+var sgrReset = map[*regexp.Regexp]string{
+  regexp.MustCompile(`\x1b\[3[0-7]m`): "\x1b[39m",
+  regexp.MustCompile(`\x1b\[4[0-7]m`): "\x1b[49m",
+  regexp.MustCompile(`\x1b\[[1-2]m`): "\x1b[22m",
+  regexp.MustCompile(`\x1b\[3m`): "\x1b[23m",
+  regexp.MustCompile(`\x1b\[4m`): "\x1b[24m",
+  regexp.MustCompile(`\x1b\[9m`): "\x1b[29m",
+}
+
+var sgrRe *regexp.Regexp = regexp.MustCompile(
+  `\x1b\[[0-9;]*m`,
+)
+
+// TextWidth returns the number of columns s takes on screen,
+// measured per grapheme cluster and ignoring escape sequences.
+func TextWidth(s string) (width int) {
+  g := uniseg.NewGraphemes(sgrRe.ReplaceAllString(s, ""))
+  for g.Next() {width += clusterWidth(g.Runes())}
+  return
+}
+
+// clusterWidth is the width of a grapheme cluster: the width of
+// its first visible rune, or two for emoji presentation and flags.
+func clusterWidth(runes []rune) int {
+  if runes[0] == softHyphen {return 0}
+  for _, r := range runes {
+    if r == 0xFE0F {return 2}
+  }
+  if r := runes[0]; r >= 0x1F1E6 && r <= 0x1F1FF {return 2}
+  for _, r := range runes {
+    if w := runewidth.RuneWidth(r); w > 0 {return w}
+  }
+  return 0
+}
+
+// Clip cuts s to at most w columns without splitting a grapheme
+// cluster, keeping the escape sequences it passes.
+func Clip(s string, w int) string {
+  var res strings.Builder
+  col := 0
+  for s != "" {
+    text := s
+    loc := sgrRe.FindStringIndex(s)
+    if loc != nil {text = s[:loc[0]]}
+
+    g := uniseg.NewGraphemes(text)
+    for g.Next() {
+      cw := clusterWidth(g.Runes())
+      if col + cw > w {return res.String()}
+      res.WriteString(g.Str())
+      col += cw
+    }
+
+    if loc == nil {break}
+    res.WriteString(s[loc[0]:loc[1]])
+    s = s[loc[1]:]
+  }
+  return res.String()
+}
+
+const softHyphen = 0x00AD
+
+// unit is a grapheme cluster along with the escape sequences
+// written before it.
+type unit struct {
+  esc   string
+  text  string
+  first rune
+  width int
+
+  level int     // bidi embedding level
+  state string  // escape sequences in effect, for reordering
+  ruby  string  // reading of the base text starting here
+  span  int     // units in that base text
+  glue  bool    // inside ruby base text, which is not broken
+}
+
+func (this unit) space() bool {
+  return this.first == ' ' || this.first == '\t'
+}
+
+func (this unit) letter() bool {
+  return unicode.IsLetter(this.first) || unicode.IsMark(this.first)
+}
+
+func splitUnits(s string) (units []unit) {
+  var esc string
+  for s != "" {
+    text := s
+    loc := sgrRe.FindStringIndex(s)
+    if loc != nil {text = s[:loc[0]]}
+
+    g := uniseg.NewGraphemes(text)
+    for g.Next() {
+      runes := g.Runes()
+      text := g.Str()
+      // Soft hyphens only show up where a line is broken.
+      if runes[0] == softHyphen {text = ""}
+      units = append(units, unit{
+        esc: esc,
+        text: text,
+        first: runes[0],
+        width: clusterWidth(runes),
+      })
+      esc = ""
+    }
+
+    if loc == nil {break}
+    esc += s[loc[0]:loc[1]]
+    s = s[loc[1]:]
+  }
+  if esc != "" {units = append(units, unit{esc: esc})}
+  return
+}
+
+// joinUnits prints a line, leaving out its trailing spaces but
+// not the escape sequences that came with them. When fill is
+// larger than the line, the spaces between words are widened
+// to take up the difference. It also returns the column each
+// unit starts at.
+func joinUnits(units []unit, fill int) (string, []int) {
+  last := len(units) - 1
+  for last >= 0 && (units[last].space() || units[last].text == "") {last--}
+
+  width, gaps := 0, 0
+  for _, u := range units[:last + 1] {
+    width += u.width
+    if u.space() {gaps++}
+  }
+  extra := fill - width
+  if extra < 0 || gaps == 0 {extra = 0}
+
+  var res strings.Builder
+  cols := make([]int, len(units))
+  gap, col := 0, 0
+  for i, u := range units {
+    cols[i] = col
+    res.WriteString(u.esc)
+    if i > last {continue}
+    res.WriteString(u.text)
+    col += u.width
+    if u.space() && extra > 0 {
+      n := extra / gaps
+      if gap < extra % gaps {n++}
+      res.WriteString(strings.Repeat(" ", n))
+      col += n
+      gap++
+    }
+  }
+  return res.String(), cols
+}
+
+// Wrap says how lines are filled when text is wrapped.
+type Wrap struct {
+  Width   int
+  Hyphens *Hyphenator  // nil to only break at soft hyphens
+  Justify bool         // widen spaces to fill all but last lines
+  Dir     string       // "rtl", "ltr" or "" to tell from the text
+  Vertical bool        // every grapheme takes a full width cell
+  Ruby    int          // RubyAbove, RubyInline or RubyHidden
+  Height  int          // rows a picture may take, 0 for any
+  Graphics int         // how pictures are drawn, as for Screen
+}
+
+// width measures s as Lines does.
+func (this Wrap) width(s string) int {
+  if !this.Vertical {return TextWidth(s)}
+  w := 0
+  for _, u := range splitUnits(s) {
+    if u.width > 0 {w += 2}
+  }
+  return w
+}
+
+// WordWrap breaks s into lines of at most limit columns.
+func WordWrap(s string, limit int) []string {
+  return Wrap{Width: limit}.Lines(s)
+}
+
+// Lines breaks s at the line break opportunities of UAX #14,
+// hyphenating the word that does not fit when it can. Other
+// words longer than a line are cut where it does the least harm.
+func (this Wrap) Lines(s string) (result []string) {
+  limit := this.Width
+  if limit < 1 {limit = 1}
+  if this.Ruby != RubyAbove {s = rubyInline(s, this.Ruby)}
+  units := rubyUnits(splitUnits(s))
+  fits := true
+  bidi := this.resolve(units)
+  if this.Vertical {
+    for i := range units {
+      if units[i].width == 1 {units[i].width = 2}
+    }
+  }
+
+  start, width, brk := 0, 0, -1
+  carry := ""
+  for i := 0; i < len(units); i++ {
+    u := units[i]
+    if i > start && !u.glue && canBreak(units[i - 1].first, u.first) {
+      // Breaking at a soft hyphen needs room to print it.
+      if units[i - 1].first != softHyphen || width < limit {brk = i}
+    }
+    if u.space() || width + u.width <= limit || i == start {
+      width += u.width
+      continue
+    }
+
+    cut, hyphen := brk, false
+    if brk > start && units[brk - 1].first == softHyphen {hyphen = true}
+    if h := this.hyphenate(units, start, i, limit); h > cut {
+      cut, hyphen = h, true
+    }
+    if cut <= start {
+      cut = i
+      for cut > start + 1 &&
+        !canForce(units[cut - 1].first, units[cut].first) {cut--}
+    }
+
+    fill := 0
+    if this.Justify {fill = limit}
+    line := units[start:cut]
+    if hyphen {
+      last := line[len(line) - 1]
+      line = append(line[:len(line):len(line)], unit{
+        text: "-", width: 1, level: last.level, state: last.state,
+      })
+    }
+    if bidi {line = reorder(line)}
+    text, cols := joinUnits(line, fill)
+    ruby, ok := rubyLine(line, cols, limit)
+    if ruby != "" {result = append(result, ruby)}
+    result = append(result, carry + text)
+    fits = fits && ok
+
+    // Spaces the line was broken at are dropped along with it.
+    carry = ""
+    for cut < len(units) && units[cut].space() {
+      carry += units[cut].esc
+      cut++
+    }
+    start, width, brk = cut, 0, -1
+    i = cut - 1
+  }
+  line := units[start:]
+  if bidi && len(line) > 0 {line = reorder(line)}
+  text, cols := joinUnits(line, 0)
+  ruby, ok := rubyLine(line, cols, limit)
+  if ruby != "" {result = append(result, ruby)}
+  result = append(result, carry + text)
+
+  // Readings that cannot sit over their base go inline instead.
+  if !fits || !ok {
+    this.Ruby = RubyInline
+    return this.Lines(s)
+  }
+
+  for i, v := range result {
+    n := i+1
+    if n != len(result) {
+      var sequel, terminator string
+      for regex, rep := range sgrReset {
+        reset := strings.LastIndex(v, rep)
+        if r := strings.LastIndex(v, "\x1b[m"); r > reset {reset = r}
+        match := regex.FindAllStringIndex(v, -1)
+        if len(match) > 0 && match[len(match) - 1][0] > reset {
+          last := match[len(match) - 1]
+          terminator += rep
+          sequel += v[last[0]:last[1]]
+        }
+      }
+
+      result[n] = sequel + result[n]
+      result[i] += terminator
+    }
+  }
+  return
+}
+
+// hyphenate returns where to cut the line from start to fit the
+// hyphen and the first part of the word reaching past units[i],
+// or -1. Words with soft hyphens are only broken at those.
+func (this Wrap) hyphenate(units []unit, start, i, limit int) int {
+  if this.Hyphens == nil || !units[i].letter() {return -1}
+
+  ws, we := i, i
+  for ws > start && units[ws - 1].letter() {ws--}
+  for we < len(units) && units[we].letter() {we++}
+
+  var word strings.Builder
+  for _, u := range units[ws:we] {
+    if u.first == softHyphen {return -1}
+    word.WriteString(u.text)
+  }
+
+  // Hyphenation points count runes, units count graphemes.
+  at := map[int]int{}
+  n := 0
+  for k, u := range units[ws:we] {
+    at[n] = ws + k
+    n += len([]rune(u.text))
+  }
+
+  width := 0
+  for _, u := range units[start:ws] {width += u.width}
+  cut := -1
+  for _, p := range this.Hyphens.Points(word.String()) {
+    k, ok := at[p]
+    if !ok {continue}
+    w := width
+    for _, u := range units[ws:k] {w += u.width}
+    if w + 1 <= limit {cut = k}
+  }
+  return cut
+}
+
+// resolve sets the bidi levels of units, and the escape sequences
+// each of them is printed with, reporting whether any line may
+// need reordering.
+func (this Wrap) resolve(units []unit) bool {
+  classes := make([]int, len(units))
+  runes := make([]rune, len(units))
+  rtl := this.Dir == "rtl"
+  for i, u := range units {
+    classes[i] = bidiClass(u.first)
+    runes[i] = u.first
+    switch classes[i] {
+      case bdR, bdAL, bdAN, bdRLE, bdRLO, bdRLI, bdFSI: {rtl = true}
+    }
+  }
+  if !rtl {return false}
+
+  base := paragraphLevel(classes)
+  switch this.Dir {
+    case "rtl": {base = 1}
+    case "ltr": {base = 0}
+  }
+  if base < 0 {base = 0}
+
+  state := ""
+  for i, level := range bidiLevels(classes, runes, base) {
+    state = activeSGR(state + units[i].esc)
+    units[i].level = level
+    units[i].state = state
+  }
+  return true
+}
+
+// activeSGR reduces a run of escape sequences to the ones whose
+// effect has not been reset since.
+func activeSGR(s string) string {
+  if i := strings.LastIndex(s, "\x1b[m"); i >= 0 {s = s[i + 3:]}
+
+  var active [][2]int
+  for regex, rep := range sgrReset {
+    match := regex.FindAllStringIndex(s, -1)
+    if len(match) == 0 {continue}
+    last := match[len(match) - 1]
+    if last[0] > strings.LastIndex(s, rep) {active = append(active, [2]int{last[0], last[1]})}
+  }
+  sort.Slice(active, func(i, j int) bool {return active[i][0] < active[j][0]})
+
+  var res strings.Builder
+  for _, v := range active {res.WriteString(s[v[0]:v[1]])}
+  return res.String()
+}
+
+// reorder puts a line in display order, mirroring brackets in
+// right to left runs. As escape sequences no longer follow the
+// text, each unit restates the style in effect at it.
+func reorder(line []unit) []unit {
+  n := len(line)
+  for n > 0 && (line[n - 1].space() || line[n - 1].text == "") {n--}
+
+  levels := make([]int, n)
+  for i, u := range line[:n] {levels[i] = u.level}
+
+  res := make([]unit, 0, n + 1)
+  state := "\x00"
+  for _, k := range visualOrder(levels) {
+    u := line[k]
+    u.esc = ""
+    if u.state != state {
+      u.esc = "\x1b[m" + u.state
+      state = u.state
+    }
+    if m, ok := bidiMirrors[u.first]; ok && u.level % 2 == 1 {
+      u.text = string(m)
+    }
+    res = append(res, u)
+  }
+  return append(res, unit{esc: "\x1b[m" + line[len(line) - 1].state})
+}
@@ -0,0 +1,50 @@
+package render
+
+import (
+  "testing"
+  "reflect"
+)
+
+func TestWordWrap(t *testing.T) {
+  for _, c := range []struct {
+    text  string
+    width int
+    want  []string
+  }{
+    {"a quick brown fox jumps over", 10, []string{"a quick", "brown fox", "jumps over"}},
+    // Ideographs break anywhere but before closing punctuation.
+    {"日本語の文章を折り返す。", 8, []string{"日本語の", "文章を折", "り返す。"}},
+    {"(see this) and “that”", 9, []string{"(see", "this) and", "“that”"}},
+    {"supercalifragilistic", 8, []string{"supercal", "ifragili", "stic"}},
+    {"co\u00adop\u00aderation", 5, []string{"coop-", "erati", "on"}},
+    {"\x1b[1mbold words\x1b[22m", 6, []string{"\x1b[1mbold\x1b[22m", "\x1b[1mwords\x1b[22m"}},
+    {"narrow", 0, []string{"n", "a", "r", "r", "o", "w"}},
+  } {
+    if got := WordWrap(c.text, c.width); !reflect.DeepEqual(got, c.want) {
+      t.Errorf("%q at %d: %q, want %q", c.text, c.width, got, c.want)
+    }
+  }
+}
+
+func TestCanBreak(t *testing.T) {
+  for _, c := range []struct {
+    a, b rune
+    want bool
+  }{
+    {' ', 'a', true},
+    {'a', ' ', false},
+    {'a', 'b', false},
+    {'日', '本', true},
+    {'本', '。', false},
+    {'(', 'a', false},
+    {'a', ')', false},
+    {'\u00a0', 'a', false},
+    {'-', 'a', true},
+    {'-', '1', false},
+    {'\u200b', 'a', true},
+  } {
+    if got := canBreak(c.a, c.b); got != c.want {
+      t.Errorf("%q %q: %v, want %v", c.a, c.b, got, c.want)
+    }
+  }
+}
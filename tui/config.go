@@ -1,4 +1,4 @@
-package main
+package tui
 
 import (
   tea "github.com/charmbracelet/bubbletea"
@@ -7,10 +7,21 @@ import (
   "strings"
   "fmt"
   "os"
+  "github.com/MD-IS/levt/render"
 )
 
 const CONF_DIRNAME = "levt"
 
+// Hyphenation patterns put in the config dir come first.
+func init() {
+  if dir, err := os.UserConfigDir(); err == nil {
+    render.HyphenDirs = append(
+      []string{filepath.Join(dir, CONF_DIRNAME, "hyphen")},
+      render.HyphenDirs...,
+    )
+  }
+}
+
 type StartConf struct {
   Title     string  `json:"title"`
   Index     int     `json:"index"`
@@ -22,8 +33,9 @@ type StartConf struct {
 type Config struct {
   LastRead    StartConf `json:"lastRead"`
   Bookmarks []StartConf `json:"bookmarks"`
+  Books  map[string]bool `json:"opened"`  // absolute paths of the books opened
 
-  onExit      func(int)
+  OnExit      func(int)  `json:"-"`  // called with the bookmark chosen, or -1
   promptText  string
   prompt      bool
   exiting     bool
@@ -50,7 +62,7 @@ func (this Config) Update(
             this.promptText = ""
             this.prompt = false
           } else {
-            this.onExit(-1)
+            this.OnExit(-1)
             this.exiting = true
             return this, tea.Quit
           }
@@ -68,7 +80,7 @@ func (this Config) Update(
             this.promptText = ""
             this.prompt = false
           } else {
-            this.onExit(this.index)
+            this.OnExit(this.index)
             this.exiting = true
             return this, tea.Quit
           }
@@ -112,14 +124,14 @@ func (this Config) View() string {
   scs := append(this.Bookmarks, this.LastRead)
   for i, v := range scs {
     t := v.String()
-    if len(t) + 2 > this.width {
+    if render.TextWidth(t) + 2 > this.width {
       split := strings.Split(t, "]")
       last := len(split) - 1
       suffix := split[last]
-      margin := 4 + len(suffix)
+      margin := 4 + render.TextWidth(suffix)
       if this.width > margin {
         rst := strings.Join(split[:last], "]")
-        shrt := rst[:this.width - margin]
+        shrt := render.Clip(rst, this.width - margin)
         t = shrt + "…]" + suffix
       }
     }
@@ -168,6 +180,19 @@ func (this *Config) Save() error {
   return nil
 }
 
+// Opened reports whether the book at path has been opened before.
+func (this *Config) Opened(path string) bool {
+  fp, _ := filepath.Abs(path)
+  return this.Books[fp]
+}
+
+// SetOpened records the book at path as opened.
+func (this *Config) SetOpened(path string) {
+  fp, _ := filepath.Abs(path)
+  if this.Books == nil {this.Books = map[string]bool{}}
+  this.Books[fp] = true
+}
+
 func (this *StartConf) String() string {
   return fmt.Sprintf(
     "[%s]:%d:%d",
@@ -177,11 +202,18 @@ func (this *StartConf) String() string {
   )
 }
 
-func getConfig() (config Config, err error) {
+func GetConfig() (config Config, err error) {
   path := getConfigPath()
   byt, err := os.ReadFile(path)
   if err != nil {byt = []byte("{}")}
   err = json.Unmarshal(byt, &config)
+  // Configs written before opened books were recorded have them
+  // in the last read and the bookmarks only.
+  if config.Books == nil {
+    for _, b := range append(config.Bookmarks, config.LastRead) {
+      if b.FilePath != "" {config.SetOpened(b.FilePath)}
+    }
+  }
   return
 }
 
@@ -0,0 +1,19 @@
+package tui
+
+import (
+  "testing"
+)
+
+func TestOpened(t *testing.T) {
+  t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+  t.Setenv("HOME", t.TempDir())
+  config, _ := GetConfig()
+  if config.Opened("a.epub") {t.Fatal("new book taken as opened")}
+  config.SetOpened("a.epub")
+  if err := config.Save(); err != nil {t.Fatal(err)}
+
+  config, _ = GetConfig()
+  if !config.Opened("a.epub") || config.Opened("b.epub") {
+    t.Errorf("opened books not kept: %v", config.Books)
+  }
+}
@@ -0,0 +1,53 @@
+package tui
+
+import (
+  "os"
+  "fmt"
+  "strings"
+
+  tea "github.com/charmbracelet/bubbletea"
+  "golang.org/x/term"
+  "github.com/MD-IS/levt/render"
+)
+
+// PrintCover writes the cover below the cursor, in the width and
+// height of the terminal.
+func PrintCover(screen *render.Screen, pic *render.Picture) {
+  width, height, err := term.GetSize(int(os.Stdout.Fd()))
+  if err != nil {width, height = 80, 24}
+  fmt.Print(screen.Print(pic, width, height - 2))
+}
+
+// coverView draws the cover centred on the screen, as the book
+// opens for the first time.
+func (this Viewer) coverView() string {
+  lines, row, col := this.coverLayout()
+  c := make([]string, this.Height)
+  for i := range c {
+    c[i] = "\x1b[m"
+    if i >= row && i - row < len(lines) {
+      c[i] += strings.Repeat(" ", col) + lines[i - row]
+    }
+  }
+  hint := "\x1b[7m " + this.EPUBTitle + ", press any key to read \x1b[m"
+  c = append(c, "\x1b[m" + render.Clip(hint, this.Width + 4) + "\x1b[m")
+  return strings.Join(c, "\n")
+}
+
+// coverLayout renders the cover for the screen, returning the
+// row and column it starts at.
+func (this Viewer) coverLayout() (lines []string, row, col int) {
+  lines = this.Cover.Render(this.Width + 4, this.Height, this.graphics())
+  row = (this.Height - len(lines)) / 2
+  col = (this.Width + 4 - this.Cover.Cols()) / 2
+  if row < 0 {row = 0}
+  if col < 0 {col = 0}
+  return
+}
+
+// closeCover leaves the cover for the text.
+func (this Viewer) closeCover() (tea.Model, tea.Cmd) {
+  this.Cover = nil
+  this.drawPictures()
+  return this, nil
+}
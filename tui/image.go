@@ -0,0 +1,62 @@
+package tui
+
+import (
+  "os"
+  "sync"
+  "strings"
+
+  "github.com/MD-IS/levt/render"
+)
+
+// output is what the program writes its frames to. The pictures
+// the terminal draws itself are written after the frame leaving
+// room for them, so that the two never interleave.
+type output struct {
+  file    *os.File
+  mu      sync.Mutex
+  pending string
+}
+
+func (this *output) Write(p []byte) (int, error) {
+  this.mu.Lock()
+  defer this.mu.Unlock()
+  n, err := this.file.Write(p)
+  if err == nil && this.pending != "" {
+    _, err = this.file.WriteString(this.pending)
+    this.pending = ""
+  }
+  return n, err
+}
+
+// drawPictures has the pictures on the page that the terminal
+// draws itself written with the next frame.
+func (this Viewer) drawPictures() {
+  if this.out == nil || this.graphics() < render.GraphicsKitty {return}
+
+  var out strings.Builder
+  if this.graphics() == render.GraphicsKitty {out.WriteString("\x1b_Ga=d,d=a,q=2\x1b\\")}
+
+  p := this.Page
+  if this.Cover != nil {
+    _, row, col := this.coverLayout()
+    out.WriteString(this.Screen.Draw(this.Cover, row + 1, col + 1))
+  } else if !this.TocMode && this.Note == nil && !this.DebugMode &&
+    !this.Vertical && p < len(this.Pages) {
+    var vlen int
+    if p > 0 {vlen = this.PageLen[p - 1]}
+
+    doc := &this.EpubItems[this.Index]
+    row := 0
+    for i, v := range this.Pages[p] {
+      if _, b := doc.Paragraph(vlen + i); b != nil && b.Picture != nil && len(v) > 0 {
+        col := 2 + render.TextWidth(v[0]) - b.Picture.Cols()
+        out.WriteString(this.Screen.Draw(b.Picture, row + 1, col + 1))
+      }
+      row += len(v)
+    }
+  }
+
+  this.out.mu.Lock()
+  this.out.pending = out.String()
+  this.out.mu.Unlock()
+}
@@ -0,0 +1,732 @@
+// Package tui is the terminal reader of levt, built on bubbletea.
+package tui
+
+import (
+  "os"
+  "io"
+  "fmt"
+  "time"
+  "strings"
+  "path/filepath"
+
+  tea "github.com/charmbracelet/bubbletea"
+  "github.com/MD-IS/levt/render"
+  "github.com/MD-IS/levt/epub"
+)
+
+// Viewer is the bubbletea model reading a book, or a single
+// XHTML file, page by page.
+type Viewer struct {
+  DebugMode       bool
+  EPUBTitle       string
+  FilePath        string
+  Files           epub.Resources
+  Pages     [][][]string
+  Logs          []string
+  Hint            string
+
+  Page            int
+  Index           int
+  Width           int
+  Height          int
+  Cursor          int
+  PageLen       []int
+  EpubItems     []render.Document
+  Hyperlinks  map[int]string
+  Noterefs    map[int][]string
+
+  NoteIndex       int
+  NoteScroll      int
+  Note          []string
+
+  TocMode         bool
+  TocIndex        int
+  Toc         []*epub.TocEntry
+
+  Justify         bool
+  NoHyphens       bool
+  RTL             bool  // pages progress from right to left
+  Vertical        bool  // lines run top to bottom, right to left
+  Ruby            int   // where ruby readings go, render.RubyAbove...
+  Cover          *render.Picture  // shown until a key is pressed
+  Screen         *render.Screen   // how pictures are drawn, nil for half blocks
+
+  out            *output  // the terminal, when it draws pictures itself
+}
+
+// graphics is the way the screen draws pictures.
+func (this *Viewer) graphics() int {
+  if this.Screen == nil {return render.GraphicsBlocks}
+  return this.Screen.Graphics
+}
+
+func (this *Viewer) RenderText(cursor int) {
+  t := time.Now()
+
+  this.Hyperlinks = make(map[int]string)
+  this.Noterefs = make(map[int][]string)
+  this.Pages = [][][]string{}
+
+  this.SetPages(cursor + this.Height)
+  this.SetCursor(cursor)
+
+  this.Logs = append(this.Logs, fmt.Sprintf(
+    "%f: RenderText %d size %dx%d",
+    time.Since(t).Seconds(),
+    this.Index,
+    this.Width,
+    this.Height,
+  ))
+}
+
+// SetCursor moves the cursor to the paragraph and shows the
+// page it is on.
+func (this *Viewer) SetCursor(cursor int) {
+  this.Cursor = cursor
+  this.Page = 0
+  last := len(this.Pages) - 1
+  for i, v := range this.PageLen {
+    if this.Cursor >= v {
+      this.Page = i + 1
+      if this.Page > last {
+        this.Page = last
+      }
+    }
+  }
+}
+
+func (this Viewer) Init() tea.Cmd {
+  return nil
+}
+
+func (this Viewer) Update(
+  message tea.Msg,
+) (tea.Model, tea.Cmd) {
+  switch msg := message.(type) {
+    case tea.WindowSizeMsg: {
+      this.Height = msg.Height - 1
+      this.Width = msg.Width - 4
+
+      this.EpubItems[this.Index].Close()
+
+      this.RenderText(this.Cursor)
+    }
+    case tea.KeyMsg: {
+      key := msg.String()
+      if this.Cover != nil {return this.closeCover()}
+      if this.DebugMode {
+        model := this.debug(key)
+        this.drawPictures()
+        return model, nil
+      }
+      if this.TocMode {
+        model := this.toc(key)
+        this.drawPictures()
+        return model, nil
+      }
+      if this.Note != nil {
+        model := this.note(key)
+        this.drawPictures()
+        return model, nil
+      }
+
+      c := &this.Cursor
+      p := &this.Page
+
+      pl := this.PageLen
+      end := 0
+      if len(pl) > 0 {end = pl[len(pl) - 1]}
+
+      this.Hint = ""
+      if k, ok := verticalKeys[key]; ok && this.Vertical {key = k}
+      switch key {
+        case "enter": {
+          link, ok := this.Hyperlinks[*c]
+          if ok {
+            base := this.EpubItems[this.Index].Href
+            link = epub.ResolveHref(base, link)
+
+            this.Logs = append(
+              this.Logs, "Enter :" + link,
+            )
+
+            if this.Noterefs[*c] != nil && this.openNote(0) {
+              break
+            }
+
+            if !this.Goto(link) {
+              err := Open(this.Files, link)
+              if err != nil {
+                this.Hint = "\x1b[41m Cannot open " +
+                  link + " \x1b[m"
+              }
+            }
+          }
+        }
+        case "t": {
+          if len(this.Toc) == 0 {
+            this.Hint = "\x1b[41m No table of contents \x1b[m"
+            break
+          }
+          this.TocMode = true
+          this.TocIndex = 0
+          path := this.tocPath()
+          for i, e := range path {
+            if i < len(path) - 1 {e.Open = true}
+          }
+          if len(path) > 0 {
+            for i, l := range epub.TocLines(this.Toc, 0) {
+              if l.Entry == path[len(path) - 1] {this.TocIndex = i}
+            }
+          }
+        }
+        case "ctrl+a", "home": {
+          *c = 0
+          *p = 0
+        }
+        case "ctrl+e", "end": {
+          *c = this.SetPages(-1)
+          *p = len(this.Pages) - 1
+        }
+
+        case "k", "up": {
+          if *c > 0 {*c--}
+          if *p > 0 && pl[*p - 1] > *c {
+            *c = pl[*p - 1] - 1
+            *p--
+          }
+        }
+        case "j", "down": {
+          if *c < end {*c++}
+          if *p < (len(pl) - 1) && pl[*p] <= *c {
+            *c = pl[*p]
+            *p++
+          }
+        }
+        case "q", "ctrl+d": {
+          if this.EPUBTitle == "" {
+            this.EPUBTitle = this.FilePath
+          }
+
+          config, _ := GetConfig()
+          fp, _ := filepath.Abs(this.FilePath)
+          config.LastRead = StartConf{
+            IsXHTML: this.EPUBTitle == this.FilePath,
+            Title: this.EPUBTitle,
+            Index: this.Index,
+            FilePath: fp,
+            Cursor: *c,
+          }
+          config.Save()
+          return this, tea.Quit
+        }
+        case "ctrl+b": {
+          if this.EPUBTitle == "" {
+            this.EPUBTitle = this.FilePath
+          }
+
+          config, _ := GetConfig()
+          fp, _ := filepath.Abs(this.FilePath)
+          b := StartConf{
+            IsXHTML: this.EPUBTitle == this.FilePath,
+            Title: this.EPUBTitle,
+            Index: this.Index,
+            FilePath: fp,
+            Cursor: *c,
+          }
+          config.Bookmarks = append(
+            config.Bookmarks, b,
+          )
+          if err := config.Save(); err == nil {
+            h := fmt.Sprintf(
+              "\x1b[44m Bookmark [+] %s \x1b[m",
+              b.String(),
+            )
+            this.Logs = append(this.Logs, h)
+            this.Hint = h
+          } else {
+            this.Hint = "\x1b[41m unable to save Bookmark \x1b[m"
+          }
+        }
+
+        case "d": {
+          this.DebugMode = true
+        }
+
+        case "J", "-", "V", "R": {
+          switch key {
+            case "J": {this.Justify = !this.Justify}
+            case "-": {this.NoHyphens = !this.NoHyphens}
+            case "V": {this.Vertical = !this.Vertical}
+            case "R": {
+              this.Ruby = (this.Ruby + 1) % len(render.RubyModes)
+              this.Hint = "\x1b[7m Ruby: " + render.RubyModes[this.Ruby] + " \x1b[m"
+            }
+          }
+          this.EpubItems[this.Index].Close()
+          this.RenderText(this.Cursor)
+        }
+
+        case " ": {
+          *c = pl[*p]
+          if *p < (len(pl) - 1) {*p++}
+        }
+        case "backspace": {
+          if *p > 1 {
+            *c = pl[*p - 2]
+            *p--
+          } else {
+            *c = 0
+            *p = 0
+          }
+        }
+
+        case "left", "right", "[", "]": {
+          step := 1
+          if key == "left" || key == "[" {step = -1}
+          if this.RTL && (key == "left" || key == "right") {step = -step}
+
+          next := this.Index + step
+          if next >= 0 && next < len(this.EpubItems) {
+            this.EpubItems[this.Index].Close()
+
+            this.Index = next
+            this.RenderText(0)
+          }
+        }
+      }
+    }
+  }
+
+  last := len(this.Pages) - 1
+  if this.Page == last {this.SetPages(this.Height)}
+
+  this.drawPictures()
+  return this, nil
+}
+
+// Goto opens the spine item link points to and moves the
+// cursor to its fragment, reporting whether it is part of the book.
+func (this *Viewer) Goto(link string) bool {
+  split := strings.SplitN(link, "#", 2)
+  index := -1
+  for i, item := range this.EpubItems {
+    if item.Href == split[0] {index = i}
+  }
+  if index < 0 {return false}
+
+  cur := &this.EpubItems[this.Index]
+  if index != this.Index || !cur.Loaded() {
+    cur.Close()
+    this.Index = index
+    this.RenderText(0)
+  } else {
+    this.SetCursor(0)
+  }
+
+  if len(split) > 1 && split[1] != "" {
+    if !this.Seek(split[1]) {
+      this.Hint = "\x1b[41m Cannot find #" + split[1] + " \x1b[m"
+    }
+  }
+  return true
+}
+
+// Seek renders the current item until the element with the
+// given id is reached and puts the cursor on it.
+func (this *Viewer) Seek(id string) bool {
+  item := &this.EpubItems[this.Index]
+  o, ok := item.Anchors[id]
+  for !ok {
+    offset := item.Offset
+    this.SetPages(this.Height)
+    if item.Offset == offset {return false}
+    o, ok = item.Anchors[id]
+  }
+
+  if rest := o + this.Height - item.Offset; rest > 0 {
+    this.SetPages(rest)
+  }
+  this.SetCursor(o)
+  return true
+}
+
+func (this *Viewer) toc(key string) tea.Model {
+  lines := epub.TocLines(this.Toc, 0)
+  i := &this.TocIndex
+  if *i >= len(lines) {*i = len(lines) - 1}
+  entry := lines[*i].Entry
+
+  this.Hint = ""
+  switch key {
+    case "q", "t", "esc": {this.TocMode = false}
+
+    case "k", "up": {
+      if *i > 0 {*i--}
+    }
+    case "j", "down": {
+      if *i < len(lines) - 1 {*i++}
+    }
+    case "ctrl+a", "home": {*i = 0}
+    case "ctrl+e", "end": {*i = len(lines) - 1}
+
+    case "l", "right", " ": {
+      if len(entry.Children) > 0 {entry.Open = !entry.Open}
+    }
+    case "h", "left": {
+      if entry.Open {
+        entry.Open = false
+        break
+      }
+      for j := *i - 1; j >= 0; j-- {
+        if lines[j].Depth < lines[*i].Depth {
+          *i = j
+          break
+        }
+      }
+    }
+
+    case "enter": {
+      if entry.Href == "" {
+        entry.Open = !entry.Open
+        break
+      }
+      this.Logs = append(this.Logs, "Toc :" + entry.Href)
+      if this.Goto(entry.Href) {
+        this.TocMode = false
+      } else {
+        this.Hint = "\x1b[41m Cannot open " + entry.Href + " \x1b[m"
+      }
+    }
+  }
+
+  return this
+}
+
+// openNote shows the i-th note referenced from the paragraph
+// under the cursor.
+func (this *Viewer) openNote(i int) bool {
+  refs := this.Noterefs[this.Cursor]
+  if i < 0 || i >= len(refs) {return false}
+
+  base := this.EpubItems[this.Index].Href
+  note := render.NoteText(this.Files, epub.ResolveHref(base, refs[i]))
+  if note == nil {return false}
+
+  this.Note = note
+  this.NoteIndex = i
+  this.NoteScroll = 0
+  return true
+}
+
+func (this *Viewer) note(key string) tea.Model {
+  lines, max := this.noteLines()
+  switch key {
+    case "n", "tab": {this.openNote(this.NoteIndex + 1)}
+    case "p", "shift+tab": {this.openNote(this.NoteIndex - 1)}
+    case "k", "up": {
+      if this.NoteScroll > 0 {this.NoteScroll--}
+    }
+    case "j", "down": {
+      if this.NoteScroll + max < len(lines) {this.NoteScroll++}
+    }
+    default: {this.Note = nil}
+  }
+  return this
+}
+
+// noteLines wraps the open note to the box width and returns it
+// along with the number of lines the box can show.
+func (this Viewer) noteLines() (lines []string, max int) {
+  for i, v := range this.Note {
+    if i > 0 {lines = append(lines, "")}
+    lines = append(lines, render.WordWrap(v, this.noteWidth() - 4)...)
+  }
+
+  max = this.Height * 2 / 3 - 2
+  if max < 1 {max = 1}
+  return
+}
+
+func (this Viewer) noteWidth() int {
+  if this.Width < 14 {return this.Width}
+  return this.Width - 4
+}
+
+// noteBox draws the open note as a framed box over the page.
+func (this Viewer) noteBox(c []string) []string {
+  w := this.noteWidth()
+  lines, max := this.noteLines()
+  more := len(lines) > this.NoteScroll + max
+  lines = lines[this.NoteScroll:]
+  if len(lines) > max {lines = lines[:max]}
+
+  title := "┌─ Note "
+  if n := len(this.Noterefs[this.Cursor]); n > 1 {
+    title = fmt.Sprintf("┌─ Note %d/%d ", this.NoteIndex + 1, n)
+  }
+  box := []string{
+    title + strings.Repeat("─", w - 1 - render.TextWidth(title)) + "┐",
+  }
+  for _, v := range lines {
+    pad := w - 4 - render.TextWidth(v)
+    if pad < 0 {pad = 0}
+    box = append(box, "│ " + v + "\x1b[m" + strings.Repeat(" ", pad) + " │")
+  }
+  if more {
+    box = append(box, "└" + strings.Repeat("─", w - 7) + " j ↓ ┘")
+  } else {
+    box = append(box, "└" + strings.Repeat("─", w - 2) + "┘")
+  }
+
+  top := len(c) - len(box)
+  if top < 0 {top = 0}
+  for i, v := range box {
+    if top + i < len(c) {c[top + i] = "\x1b[m  " + v}
+  }
+  return c
+}
+
+func (this *Viewer) tocPath() []*epub.TocEntry {
+  item := this.EpubItems[this.Index]
+  return epub.TocFind(this.Toc, item.Href, item.Anchors, this.Cursor)
+}
+
+func (this Viewer) tocView() string {
+  lines := epub.TocLines(this.Toc, 0)
+  h := this.Height
+  start := 0
+  if this.TocIndex >= h {start = this.TocIndex - h + 1}
+
+  var c []string
+  for i := start; i < len(lines) && i < start + h; i++ {
+    l := lines[i]
+    mark := "  "
+    if len(l.Entry.Children) > 0 {
+      mark = "▸ "
+      if l.Entry.Open {mark = "▾ "}
+    }
+
+    str := strings.Repeat("  ", l.Depth) + mark + l.Entry.Title
+    if render.TextWidth(str) > this.Width {
+      str = render.Clip(str, this.Width - 1) + "…"
+    }
+    if i == this.TocIndex {
+      str = "\x1b[7m \x1b[m " + "\x1b[33m" + str + "\x1b[m"
+    } else {
+      str = "  " + str
+    }
+    c = append(c, str)
+  }
+
+  for len(c) < h {c = append(c, "")}
+  hint := "\x1b[7m Contents: ENTER jump, SPACE expand, t close \x1b[m"
+  if this.Hint != "" {hint = this.Hint}
+  return strings.Join(append(c, "\x1b[m" + hint), "\n")
+}
+
+func (this *Viewer) debug(key string) tea.Model {
+  switch key {
+    case "q", "d": {this.DebugMode = false}
+
+    case "ctrl+l": {
+      this.Logs = []string{}
+    }
+
+    case "ctrl+r": {
+      this.EpubItems[this.Index].Close()
+
+      this.Page = 0
+      this.Cursor = 0
+      this.RenderText(0)
+    }
+
+    case "ctrl+d": {
+      byt := []byte(fmt.Sprintf("%+v\n", this))
+      os.WriteFile("dumpfile", byt, 0666)
+    }
+  }
+
+  return this
+}
+
+func (this *Viewer) SetPages(max int) int {
+  index := this.Index
+  if index < 0 || index >= len(this.EpubItems) {
+    return -1
+  }
+
+  raw := &this.EpubItems[index]
+  o := raw.Offset
+  if !raw.Loaded() {raw.Load()}
+
+  var clen int
+  var c [][]string
+  w, size := this.Width, this.Height
+  if this.Vertical {w, size = (this.Height - 1) * 2, this.columns()}
+  if len(this.Pages) != 0 {
+    l := len(this.Pages) - 1
+
+    c = this.Pages[l]
+    for _, v := range c {
+      clen += len(v)
+    }
+
+    this.Pages = this.Pages[:l]
+    this.PageLen = this.PageLen[:l]
+  }
+
+  count := 0
+  for max == -1 || count < max {
+    err := raw.Line()
+    if err == io.EOF {break}
+    count++
+  }
+
+  for i := o; i < raw.Offset; i++ {
+    line, block := raw.Paragraph(i)
+    if render.LinkRe.MatchString(line) {
+      for _, m := range render.LinkRe.FindAllStringSubmatch(line, -1) {
+        if m[1] == "note" {
+          this.Noterefs[i] = append(this.Noterefs[i], m[2])
+        }
+      }
+      m := render.LinkRe.FindStringSubmatch(line)
+      this.Hyperlinks[i] = m[2]
+      if m[1] != "note" {delete(this.Noterefs, i)}
+    }
+
+    wrap := render.Wrap{Width: w, Justify: this.Justify, Ruby: this.Ruby}
+    wrap.Graphics = this.graphics()
+    if this.Vertical {
+      wrap.Vertical = true
+      if wrap.Ruby == render.RubyAbove {wrap.Ruby = render.RubyInline}
+    } else {
+      wrap.Height = size
+    }
+
+    // Pictures are not split across pages.
+    lines := raw.Lines(i, wrap, this.NoHyphens)
+    if block != nil && block.Picture != nil && !this.Vertical &&
+      clen > 0 && clen + len(lines) > size {
+      clen = size
+    }
+
+    var p []string
+    for _, v := range lines {
+      if size <= clen {
+        newPage := append(c, p)
+        this.Pages = append(this.Pages, newPage)
+        c = [][]string{}
+        p = []string{}
+        clen = 0
+      }
+
+      p = append(p, v)
+      clen++
+    }
+    c = append(c, p)
+  }
+  if len(c) > 0 {this.Pages = append(this.Pages, c)}
+
+  var vlen int
+  this.PageLen = make([]int, len(this.Pages))
+  for i, v := range this.Pages {
+    l := len(v) - 1
+    this.PageLen[i] = vlen + l
+    vlen += l
+  }
+
+  return vlen
+}
+
+func (this Viewer) View() string {
+  index := this.Index
+  items := this.EpubItems
+  item := items[index]
+  title := item.Href
+  if path := this.tocPath(); len(path) > 0 {
+    title = path[len(path) - 1].Title
+  }
+  hint := fmt.Sprintf(
+    "\x1b[7m %d/%d %s \x1b[m",
+    index+1, len(items), title,
+  )
+
+  if this.Cover != nil {return this.coverView()}
+  if this.TocMode {return this.tocView()}
+  if !this.DebugMode {
+    p := this.Page
+    arr := this.Pages
+    if len(arr) <= p {return ""}
+
+    var vlen int
+    if p > 0 {vlen = this.PageLen[p - 1]}
+
+    if link, ok := this.Hyperlinks[this.Cursor]; ok {
+      hint = fmt.Sprintf(
+        "\x1b[7m Press ENTER to open %s \x1b[m",
+        link,
+      )
+    }
+
+    var c []string
+    if this.Vertical {c = this.verticalView(p)}
+    for i, v := range arr[p] {
+      if this.Vertical {break}
+      prefix := "\x1b[m  "
+      if this.Cursor == (vlen + i) {prefix = "\x1b[7m \x1b[m "}
+
+      for _, j := range v {c = append(c, prefix + j)}
+    }
+
+    for len(c) < this.Height {c = append(c, "")}
+    if this.Note != nil {
+      c = this.noteBox(c)
+      hint = "\x1b[7m Note: j/k scroll, n/p next, any key close \x1b[m"
+    }
+    if this.Hint != "" {hint = this.Hint}
+    hint += warning(&item)
+    c = append(c, "\x1b[m" + render.Clip(hint, this.Width + 4) + "\x1b[m")
+    return strings.Join(c, "\n")
+  } else {
+    logs := this.Logs
+    for _, d := range item.Diagnostics {logs = append(logs, d.String())}
+    return fmt.Sprintf(
+      "Item: %d\n" +
+      "Page: %d/%d\n" +
+      "Cursor: %d\n" +
+      "%v\n",
+      item.Offset,
+      this.Page + 1,
+      len(this.Pages),
+      this.Cursor,
+      this.PageLen,
+    ) + strings.Join(logs, "\n")
+  }
+}
+
+func (this *Viewer) StartProgram() {
+  options := []tea.ProgramOption{tea.WithAltScreen()}
+  // Pictures the terminal draws go through the output of the
+  // program, which then leaves the size of the terminal to us.
+  if this.graphics() >= render.GraphicsKitty {
+    this.out = &output{file: os.Stdout}
+    options = append(options, tea.WithOutput(this.out))
+  }
+  p := tea.NewProgram(this, options...)
+  if this.out != nil {defer watchSize(p, this.out.file)()}
+  if err := p.Start(); err != nil {
+    fmt.Println(err)
+  }
+}
+
+// warning is the status bar marker of a chapter that could not
+// be read as written.
+func warning(item *render.Document) string {
+  switch item.Severity() {
+    case render.DiagRepaired: {return " \x1b[33m⚠ repaired\x1b[m"}
+    case render.DiagTruncated: {return " \x1b[31m⚠ truncated\x1b[m"}
+  }
+  return ""
+}
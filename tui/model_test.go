@@ -0,0 +1,86 @@
+package tui
+
+import (
+  "os"
+  "bytes"
+  "image"
+  "strings"
+  "testing"
+  "image/png"
+  "path/filepath"
+
+  tea "github.com/charmbracelet/bubbletea"
+  "github.com/MD-IS/levt/epub"
+  "github.com/MD-IS/levt/render"
+)
+
+func testViewer() Viewer {
+  files := epub.Memory{
+    "a.xhtml": []byte(`<html><body><p>First chapter.</p><p><a href="b.xhtml">on</a></p></body></html>`),
+    "b.xhtml": []byte(`<html><body><p>Second chapter.</p></body></html>`),
+  }
+  v := Viewer{
+    Files: files,
+    EpubItems: render.Documents(files, []epub.Chapter{
+      {Item: epub.Item{Href: "a.xhtml"}},
+      {Item: epub.Item{Href: "b.xhtml"}},
+    }),
+  }
+  m, _ := v.Update(tea.WindowSizeMsg{Width: 40, Height: 10})
+  return m.(Viewer)
+}
+
+func update(v Viewer, msgs ...tea.Msg) Viewer {
+  for _, msg := range msgs {
+    m, _ := v.Update(msg)
+    v = m.(Viewer)
+  }
+  return v
+}
+
+// Going to another chapter and back shows the first one again.
+func TestViewerChapters(t *testing.T) {
+  left, right := tea.KeyMsg{Type: tea.KeyLeft}, tea.KeyMsg{Type: tea.KeyRight}
+  space := tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+
+  v := update(testViewer(), right)
+  if !strings.Contains(v.View(), "Second chapter.") {t.Fatalf("next chapter not shown: %q", v.View())}
+  v = update(v, left, space)
+  if len(v.PageLen) == 0 || !strings.Contains(v.View(), "First chapter.") {
+    t.Fatalf("chapter empty on coming back: %q", v.View())
+  }
+
+  v.Goto("b.xhtml")
+  v.Goto("a.xhtml")
+  if !strings.Contains(v.View(), "First chapter.") {
+    t.Errorf("chapter empty after a link: %q", v.View())
+  }
+}
+
+// Pictures the terminal draws are written after the frame.
+func TestViewerPictures(t *testing.T) {
+  img := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+  var buf bytes.Buffer
+  png.Encode(&buf, img)
+  files := epub.Memory{
+    "a.xhtml": []byte(`<html><body><p>Text.</p><img src="a.png" alt="A"/></body></html>`),
+    "a.png": buf.Bytes(),
+  }
+  file, err := os.Create(filepath.Join(t.TempDir(), "out"))
+  if err != nil {t.Fatal(err)}
+  defer file.Close()
+  v := Viewer{
+    Files: files,
+    EpubItems: render.Documents(files, []epub.Chapter{{Item: epub.Item{Href: "a.xhtml"}}}),
+    Screen: render.NewScreen(render.GraphicsKitty),
+    out: &output{file: file},
+  }
+  update(v, tea.WindowSizeMsg{Width: 40, Height: 20})
+  v.out.Write([]byte("frame"))
+  v.out.Write([]byte("next"))
+
+  written, _ := os.ReadFile(file.Name())
+  if !strings.HasPrefix(string(written), "frame\x1b_G") || !strings.HasSuffix(string(written), "next") {
+    t.Errorf("pictures not written after the frame: %.60q", written)
+  }
+}
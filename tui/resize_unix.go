@@ -0,0 +1,30 @@
+//go:build !windows
+
+package tui
+
+import (
+  "os"
+  "syscall"
+  "os/signal"
+
+  tea "github.com/charmbracelet/bubbletea"
+  "golang.org/x/term"
+)
+
+// watchSize sends the program the size of the terminal, now and
+// whenever it changes, until the returned function is called.
+func watchSize(p *tea.Program, file *os.File) func() {
+  sig := make(chan os.Signal, 1)
+  signal.Notify(sig, syscall.SIGWINCH)
+  go func() {
+    for ok := true; ok; _, ok = <-sig {
+      if w, h, err := term.GetSize(int(file.Fd())); err == nil {
+        p.Send(tea.WindowSizeMsg{Width: w, Height: h})
+      }
+    }
+  }()
+  return func() {
+    signal.Stop(sig)
+    close(sig)
+  }
+}
@@ -0,0 +1,19 @@
+package tui
+
+import (
+  "os"
+
+  tea "github.com/charmbracelet/bubbletea"
+  "golang.org/x/term"
+)
+
+// watchSize sends the program the size of the terminal. Windows
+// does not tell when it changes.
+func watchSize(p *tea.Program, file *os.File) func() {
+  go func() {
+    if w, h, err := term.GetSize(int(file.Fd())); err == nil {
+      p.Send(tea.WindowSizeMsg{Width: w, Height: h})
+    }
+  }()
+  return func() {}
+}
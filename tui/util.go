@@ -0,0 +1,14 @@
+package tui
+
+import "os"
+import "os/exec"
+
+import "github.com/MD-IS/levt/epub"
+
+// Open shows the file at href with xdg-open, copying it out of
+// the book first. Links to elsewhere are handed on as they are.
+func Open(files epub.Resources, href string) error {
+  src, err := epub.Extract(files, href, os.TempDir())
+  if err != nil {src = href}
+  return exec.Command("xdg-open", src).Run()
+}
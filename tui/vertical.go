@@ -0,0 +1,56 @@
+package tui
+
+import "github.com/MD-IS/levt/render"
+
+// Keys turned to follow vertical lines, which are read from right
+// to left: the arrows page and [ ] change chapters instead.
+var verticalKeys = map[string]string{
+  "left": " ",
+  "right": "backspace",
+  "h": "j",
+  "l": "k",
+  "pgdown": "]",
+  "pgup": "[",
+}
+
+// columns is the number of vertical lines a page holds.
+func (this *Viewer) columns() int {
+  n := (this.Width + 2) / 2
+  if n < 1 {n = 1}
+  return n
+}
+
+// verticalView draws the page with its lines as columns from right
+// to left, marking the paragraph at the cursor above them.
+func (this Viewer) verticalView(p int) []string {
+  var vlen int
+  if p > 0 {vlen = this.PageLen[p - 1]}
+
+  var cols [][]string
+  var marks []bool
+  for i, v := range this.Pages[p] {
+    for _, l := range v {
+      cols = append(cols, render.Cells(l))
+      marks = append(marks, this.Cursor == vlen + i)
+    }
+  }
+
+  n := this.columns()
+  rows := make([]string, this.Height)
+  for r := range rows {
+    line := "\x1b[m  "
+    for c := n - 1; c >= 0; c-- {
+      cell := "  "
+      switch {
+        case c >= len(cols): {}
+        case r == 0: {
+          if marks[c] {cell = "\x1b[7m \x1b[m "}
+        }
+        case r - 1 < len(cols[c]): {cell = cols[c][r - 1]}
+      }
+      line += cell
+    }
+    rows[r] = line
+  }
+  return rows
+}